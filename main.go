@@ -1,26 +1,136 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log"
-	"net/http"
+	"os"
 
 	"go-react-spa-server/server" // Import the new server package
 )
 
-func runApp() error {
-	finalHandler, config := server.SetupHandlers() // Load config and setup handlers
+// Exit codes reported for each phase of the server lifecycle.
+const (
+	exitOK = iota
+	exitConfigError
+	exitListenError
+	exitServeError
+	exitShutdownError
+)
+
+var errConfig = errors.New("invalid configuration")
+
+// version is set at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
+// run parses the command line and runs the requested command: "check" to
+// validate the configuration, "schema" to print the config file's JSON Schema,
+// or by default the server itself. Anything that is not the command is parsed
+// as flags.
+func run(args []string, out io.Writer) error {
+	if len(args) > 0 && args[0] == "schema" {
+		if len(args) > 1 {
+			return fmt.Errorf("%w: unexpected argument %q", errConfig, args[1])
+		}
+		return server.WriteConfigSchema(out)
+	}
+
+	checkOnly := len(args) > 0 && args[0] == "check"
+	if checkOnly {
+		args = args[1:]
+	}
 
-	if err := server.LoadCriticalAssetsIntoCache(config.StaticDir); err != nil {
+	fs := flag.NewFlagSet("go-react-spa-server", flag.ContinueOnError)
+	printConfig := fs.Bool("print-config", false, "print the effective configuration and where each value came from, then exit")
+	configFlags := server.RegisterConfigFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return fmt.Errorf("%w: %v", errConfig, err)
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%w: unexpected argument %q", errConfig, fs.Arg(0))
+	}
+
+	config, sources, err := configFlags.Load()
+	if err != nil {
+		if checkOnly || *printConfig {
+			fmt.Fprintf(out, "error: %v\n", err)
+		}
+		return fmt.Errorf("%w: %v", errConfig, err)
+	}
+	if *printConfig {
+		server.PrintConfig(out, config, sources)
+		return nil
+	}
+	if checkOnly {
+		return runCheck(out, config)
+	}
+	return runApp(config, configFlags)
+}
+
+func runApp(config *server.Config, configFlags *server.ConfigFlags) error {
+	log.Printf("Starting go-react-spa-server %s (pid %d)", version, os.Getpid())
+
+	report := server.ValidateConfig(config)
+	for _, issue := range report.Warnings {
+		log.Printf("Configuration warning: %s", issue)
+	}
+	if !report.OK() {
+		if config.StrictStartup {
+			return fmt.Errorf("%w: %v", errConfig, report)
+		}
+		for _, issue := range report.Errors {
+			log.Printf("Configuration error: %s", issue)
+		}
+	}
+
+	if err := server.LoadCriticalAssetsIntoCache(config.StaticDirOrDefault(), config.Mounts...); err != nil {
+		if config.StrictStartup {
+			return fmt.Errorf("%w: loading critical assets: %v", errConfig, err)
+		}
 		log.Printf("Error loading critical assets into cache: %v", err)
 		// Continue, as it's not a fatal error if assets are served from disk
 	}
 
-	http.Handle("/", finalHandler)
-	return server.StartServer(config, finalHandler) // Use StartServer from server package
+	// Serve, reloading the configuration when the config file changes or on SIGHUP
+	return server.StartServerWithReload(config, configFlags)
+}
+
+// runCheck validates the configuration without starting the server and
+// writes a report to out. It fails with errConfig if the report has errors.
+func runCheck(out io.Writer, config *server.Config) error {
+	report := server.ValidateConfig(config)
+	report.Write(out)
+	if !report.OK() {
+		return fmt.Errorf("%w: %d errors", errConfig, len(report.Errors))
+	}
+	return nil
+}
+
+// exitCode maps an error returned by run to the process exit code.
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, errConfig):
+		return exitConfigError
+	case errors.Is(err, server.ErrListen):
+		return exitListenError
+	case errors.Is(err, server.ErrShutdown):
+		return exitShutdownError
+	default:
+		return exitServeError
+	}
 }
 
 func main() {
-	if err := runApp(); err != nil {
-		log.Fatal(err)
+	err := run(os.Args[1:], os.Stdout)
+	if err != nil {
+		log.Print(err)
 	}
+	os.Exit(exitCode(err))
 }
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRunCheck(t *testing.T) {
+	staticDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(staticDir, "index.html"), []byte("<html>app</html>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("STATIC_DIR", staticDir)
+
+	var out bytes.Buffer
+	if err := run([]string{"check"}, &out); err != nil {
+		t.Fatalf("runCheck failed for a valid configuration: %v\n%s", err, out.String())
+	}
+	if !strings.Contains(out.String(), "Configuration OK") {
+		t.Errorf("unexpected report:\n%s", out.String())
+	}
+
+	t.Setenv("PORT", "70000")
+	t.Setenv("CSP_HEADER", "default-src self")
+	out.Reset()
+	err := run([]string{"check"}, &out)
+	if exitCode(err) != exitConfigError || !errors.Is(err, errConfig) {
+		t.Fatalf("expected a configuration error, got %v", err)
+	}
+	for _, want := range []string{
+		"error: port: 70000 is out of range (1-65535)",
+		"error: csp_header: keyword self in default-src must be quoted as 'self'",
+		"Configuration invalid (2 errors, 0 warnings)",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("report does not contain %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestRun_PrintConfig(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(configFile, []byte(`{"port": 9000, "static_dir": "./file_static", "hsts_max_age": 60}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PORT", "9001")
+	t.Setenv("STATIC_DIR", "./env_static")
+
+	var out bytes.Buffer
+	err := run([]string{"--config", configFile, "--static-dir", "./flag_static", "--h2c", "--print-config"}, &out)
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	for _, want := range []*regexp.Regexp{
+		regexp.MustCompile(`(?m)^static_dir += "./flag_static" +# flag --static-dir$`),
+		regexp.MustCompile(`(?m)^port += 9001 +# env PORT$`),
+		regexp.MustCompile(`(?m)^hsts_max_age += 60 +# file ` + regexp.QuoteMeta(configFile) + `$`),
+		regexp.MustCompile(`(?m)^h2c += true +# flag --h2c$`),
+		regexp.MustCompile(`(?m)^spa_fallback_file += "index.html" +# default$`),
+	} {
+		if !want.MatchString(out.String()) {
+			t.Errorf("output does not match %s:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestRun_Schema(t *testing.T) {
+	var out bytes.Buffer
+	if err := run([]string{"schema"}, &out); err != nil {
+		t.Fatalf("run(schema) = %v", err)
+	}
+	committed, err := ioutil.ReadFile("config.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != string(committed) {
+		t.Error("schema output differs from config.schema.json")
+	}
+}
+
+func TestRun_InvalidFlags(t *testing.T) {
+	tests := [][]string{
+		{"--port", "http"},
+		{"--no-such-flag"},
+		{"--config", filepath.Join(t.TempDir(), "missing.json")},
+		{"serve"},
+		{"schema", "--port", "9000"},
+	}
+	for _, args := range tests {
+		err := run(args, ioutil.Discard)
+		if exitCode(err) != exitConfigError {
+			t.Errorf("run(%q) = %v, want a configuration error", args, err)
+		}
+	}
+}
+
+func TestRunApp_StrictStartup(t *testing.T) {
+	t.Setenv("STATIC_DIR", filepath.Join(t.TempDir(), "missing"))
+	t.Setenv("STRICT_STARTUP", "true")
+
+	err := run(nil, ioutil.Discard)
+	if !errors.Is(err, errConfig) {
+		t.Fatalf("expected strict startup to fail with a configuration error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "static_dir") {
+		t.Errorf("error does not mention static_dir: %v", err)
+	}
+}
+
+func TestRunApp_StrictStartupUnreadableAsset(t *testing.T) {
+	staticDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(staticDir, "index.html"), []byte("<html></html>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(staticDir, "vite.svg"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("STATIC_DIR", staticDir)
+	t.Setenv("STRICT_STARTUP", "true")
+
+	err := run(nil, ioutil.Discard)
+	if !errors.Is(err, errConfig) {
+		t.Fatalf("expected strict startup to fail with a configuration error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "loading critical assets") {
+		t.Errorf("error does not mention the critical assets: %v", err)
+	}
+}
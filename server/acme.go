@@ -0,0 +1,68 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// ACMEEnabled reports whether certificates should be obtained via ACME.
+func (c *Config) ACMEEnabled() bool {
+	return len(c.ACMEDomains) > 0
+}
+
+// newACMEManager creates an autocert.Manager that obtains and renews
+// certificates for the configured domains. The manager answers TLS-ALPN-01
+// challenges through its TLS config and HTTP-01 challenges through
+// Manager.HTTPHandler on the redirect listener.
+func newACMEManager(config *Config) (*autocert.Manager, error) {
+	client := &acme.Client{DirectoryURL: config.ACMEDirectoryURL}
+	if client.DirectoryURL == "" {
+		client.DirectoryURL = autocert.DefaultACMEDirectory
+	}
+
+	if config.ACMECACertFile != "" {
+		// Trust an additional root for the directory, e.g. a local test CA such as Pebble.
+		pem, err := os.ReadFile(config.ACMECACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading ACME CA certificate: %v", err)
+		}
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in ACME CA certificate file %s", config.ACMECACertFile)
+		}
+		client.HTTPClient = &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{RootCAs: roots},
+			},
+		}
+	}
+
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(config.ACMEDomains...),
+		Email:      config.ACMEEmail,
+		Client:     client,
+	}
+	if config.ACMECacheDir != "" {
+		manager.Cache = autocert.DirCache(config.ACMECacheDir)
+	} else {
+		log.Printf("Warning: ACME_CACHE_DIR is not set, certificates will be requested again on every restart")
+	}
+	if config.HTTPRedirectPort == 0 {
+		log.Printf("HTTP_REDIRECT_PORT is not set, only TLS-ALPN-01 challenges can be answered")
+	}
+
+	log.Printf("Obtaining certificates for %v from %s", config.ACMEDomains, client.DirectoryURL)
+	return manager, nil
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewServers_ACMEChallengeBypassesRedirect(t *testing.T) {
+	port := freePort(t)
+	cfg := &Config{
+		Port:             port,
+		HTTPRedirectPort: freePort(t),
+		ACMEDomains:      []string{"example.com"},
+		ACMECacheDir:     t.TempDir(),
+	}
+	spa := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html>index</html>"))
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	servers, err := newServers(ctx, cfg, spa, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		for _, s := range servers {
+			s.listener.Close()
+		}
+	}()
+	if !assert.Len(t, servers, 2) {
+		return
+	}
+	assert.Contains(t, servers[0].server.TLSConfig.NextProtos, "acme-tls/1")
+
+	redirect := servers[1].server.Handler
+
+	// Unknown challenge tokens are answered by the ACME manager, never by the SPA or the redirect
+	req := httptest.NewRequest("GET", "/.well-known/acme-challenge/unknown-token", nil)
+	req.Host = "example.com"
+	rr := httptest.NewRecorder()
+	redirect.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "index")
+
+	// Everything else is redirected to HTTPS
+	req = httptest.NewRequest("GET", "/about?x=1", nil)
+	req.Host = "example.com"
+	rr = httptest.NewRecorder()
+	redirect.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusMovedPermanently, rr.Code)
+	assert.Equal(t, fmt.Sprintf("https://example.com:%d/about?x=1", port), rr.Header().Get("Location"))
+}
+
+// TestServe_ACMEWithPebble obtains a certificate from a local Pebble ACME test
+// server. It is skipped unless PEBBLE_DIRECTORY_URL is set, e.g.:
+//
+//	PEBBLE_VA_ALWAYS_VALID=1 pebble -config test/config/pebble-config.json &
+//	PEBBLE_DIRECTORY_URL=https://localhost:14000/dir \
+//	PEBBLE_CA_CERT_FILE=test/certs/pebble.minica.pem \
+//	go test ./server -run ACMEWithPebble
+//
+// Without PEBBLE_VA_ALWAYS_VALID, Pebble's httpPort and tlsPort must match
+// PEBBLE_HTTP_PORT (default 5002) and PEBBLE_TLS_PORT (default 5001).
+func TestServe_ACMEWithPebble(t *testing.T) {
+	directoryURL := os.Getenv("PEBBLE_DIRECTORY_URL")
+	if directoryURL == "" {
+		t.Skip("PEBBLE_DIRECTORY_URL not set")
+	}
+
+	port := envPort(t, "PEBBLE_TLS_PORT", 5001)
+	cfg := &Config{
+		Port:             port,
+		HTTPRedirectPort: envPort(t, "PEBBLE_HTTP_PORT", 5002),
+		ACMEDomains:      []string{"localhost"},
+		ACMEEmail:        "admin@example.com",
+		ACMEDirectoryURL: directoryURL,
+		ACMECacheDir:     t.TempDir(),
+		ACMECACertFile:   os.Getenv("PEBBLE_CA_CERT_FILE"),
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, cancel, cfg, handler)
+	}()
+
+	// Pebble issues from a random root, so only check that the handshake
+	// completes with a certificate issued for the requested domain.
+	var cert *x509.Certificate
+	deadline := time.Now().Add(60 * time.Second)
+	for time.Now().Before(deadline) && cert == nil {
+		conn, err := tls.Dial("tcp", fmt.Sprintf("localhost:%d", port), &tls.Config{
+			ServerName:         "localhost",
+			InsecureSkipVerify: true,
+		})
+		if err != nil {
+			time.Sleep(500 * time.Millisecond)
+			continue
+		}
+		cert = conn.ConnectionState().PeerCertificates[0]
+		conn.Close()
+	}
+	if assert.NotNil(t, cert, "no certificate obtained from Pebble") {
+		assert.NoError(t, cert.VerifyHostname("localhost"))
+		assert.NotEqual(t, cert.Issuer.String(), cert.Subject.String())
+	}
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func envPort(t *testing.T, name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	port, err := strconv.Atoi(value)
+	if err != nil {
+		t.Fatalf("invalid %s: %v", name, err)
+	}
+	return port
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"reflect"
+)
+
+// AdminHandler serves the operational endpoints on the admin listener: health,
+// liveness and readiness checks, metrics, the effective configuration and pprof. Every
+// other path is a 404; the admin listener never serves the SPA.
+func AdminHandler(config *Config) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", HealthzHandler)
+	mux.Handle("/livez", LivezHandler())
+	mux.Handle("/readyz", ReadyzHandler(config))
+	mux.HandleFunc("/metrics", MetricsHandler)
+	mux.Handle("/config", ConfigHandler(config))
+
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	mux.Handle("/", http.NotFoundHandler())
+	return mux
+}
+
+// ConfigHandler dumps the effective configuration as JSON. Values read from
+// files named by NAME_FILE variables are redacted.
+func ConfigHandler(config *Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(redactedConfig{config})
+	})
+}
+
+// redactedConfig marshals a Config the way encoding/json does, with the values
+// of its secret keys replaced by redactedValue.
+type redactedConfig struct {
+	config *Config
+}
+
+func (rc redactedConfig) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	v := reflect.ValueOf(rc.config).Elem()
+	for i, field := range configFields {
+		var value interface{} = redactedValue
+		if !rc.config.secretKeys[field.key] {
+			value = v.Field(field.index).Interface()
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(&buf, "%q:", field.key)
+		buf.Write(data)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminHandler_Routes(t *testing.T) {
+	handler := AdminHandler(&Config{Port: 8080, StaticDir: "dist"})
+
+	tests := []struct {
+		path       string
+		wantStatus int
+	}{
+		{"/healthz", http.StatusOK},
+		{"/livez", http.StatusOK},
+		{"/readyz", http.StatusServiceUnavailable}, // "dist" does not exist
+		{"/metrics", http.StatusOK},
+		{"/config", http.StatusOK},
+		{"/debug/pprof/", http.StatusOK},
+		{"/", http.StatusNotFound},
+		{"/index.html", http.StatusNotFound},
+		{"/some/client/route", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rr := httptestGet(handler, tt.path)
+			assert.Equal(t, tt.wantStatus, rr.Code)
+		})
+	}
+}
+
+func TestConfigHandler(t *testing.T) {
+	rr := httptestGet(ConfigHandler(&Config{Port: 8080, StaticDir: "dist"}), "/config")
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+	var got Config
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+	assert.Equal(t, 8080, got.Port)
+	assert.Equal(t, "dist", got.StaticDir)
+}
+
+func TestConfigHandler_RedactsSecretFiles(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "csp")
+	assert.NoError(t, os.WriteFile(secret, []byte("default-src 's3cr3t'"), 0600))
+	t.Setenv("CSP_HEADER_FILE", secret)
+	t.Setenv("PORT", "9000")
+	config, _, err := (&ConfigFlags{}).Load()
+	assert.NoError(t, err)
+
+	rr := httptestGet(ConfigHandler(config), "/config")
+	assert.NotContains(t, rr.Body.String(), "s3cr3t")
+	var got map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+	assert.Equal(t, "<redacted>", got["csp_header"])
+	assert.Equal(t, 9000.0, got["port"])
+	assert.Len(t, got, len(configFields))
+
+	// Without secrets, the dump is what encoding/json makes of the Config
+	plain := &Config{Port: 8080, StaticDir: "dist", Mounts: []Mount{{Prefix: "/admin", StaticDir: "admin"}}}
+	want, err := json.MarshalIndent(plain, "", "  ")
+	assert.NoError(t, err)
+	assert.Equal(t, string(want)+"\n", httptestGet(ConfigHandler(plain), "/config").Body.String())
+}
+
+func TestServe_AdminListener(t *testing.T) {
+	staticDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(staticDir, "index.html"), []byte("<html>spa</html>"), 0644))
+
+	port := freePort(t)
+	adminPort := freePort(t)
+	cfg := &Config{
+		Port:            port,
+		StaticDir:       staticDir,
+		SpaFallbackFile: "index.html",
+		AdminAddr:       fmt.Sprintf("127.0.0.1:%d", adminPort),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer draining.Store(false)
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, cancel, cfg, NewHandler(cfg))
+	}()
+	adminURL := fmt.Sprintf("http://127.0.0.1:%d", adminPort)
+	publicURL := fmt.Sprintf("http://localhost:%d", port)
+	waitForServer(t, adminURL+"/healthz")
+
+	get := func(url string) (int, string) {
+		resp, err := http.Get(url)
+		if !assert.NoError(t, err) {
+			return 0, ""
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	// The public listener serves only the SPA, so /healthz is a client route.
+	status, body := get(publicURL + "/healthz")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "<html>spa</html>", body)
+
+	// The admin listener never falls through to the SPA.
+	status, _ = get(adminURL + "/missing")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	status, body = get(adminURL + "/metrics")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `spa_http_requests_total{code="200"}`)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"bytes"
+	"html"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// basePath returns the configured base path without a trailing slash, or ""
+// when the server is deployed at the root.
+func (c *Config) basePath() string {
+	return strings.TrimSuffix(c.BasePath, "/")
+}
+
+// BasePathHandler serves next under basePath, e.g. /portal: the prefix is
+// stripped before next sees the request, the bare prefix redirects to its
+// trailing-slash form and anything outside the prefix is not found.
+func BasePathHandler(basePath string, next http.Handler) http.Handler {
+	basePath = strings.TrimSuffix(basePath, "/")
+	if basePath == "" {
+		return next
+	}
+	stripped := http.StripPrefix(basePath, next)
+	redirect := redirectHandler(basePath + "/")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == basePath:
+			redirect.ServeHTTP(w, r)
+		case strings.HasPrefix(r.URL.Path, basePath+"/"):
+			stripped.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// redirectHandler permanently redirects every request to target, an absolute
+// path, keeping the query string.
+func redirectHandler(target string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		location := target
+		if r.URL.RawQuery != "" {
+			location += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, location, http.StatusMovedPermanently)
+	})
+}
+
+var (
+	baseTagPattern = regexp.MustCompile(`(?i)<base(\s[^>]*)?>`)
+	headTagPattern = regexp.MustCompile(`(?i)<head(\s[^>]*)?>`)
+)
+
+// rewriteBaseHref replaces the <base> tag in an HTML document with one
+// pointing at href, or inserts one at the start of <head> if there is none.
+// Documents without a <head> are returned unchanged.
+func rewriteBaseHref(doc []byte, href string) []byte {
+	tag := []byte(`<base href="` + html.EscapeString(href) + `">`)
+	if loc := baseTagPattern.FindIndex(doc); loc != nil {
+		return bytes.Join([][]byte{doc[:loc[0]], tag, doc[loc[1]:]}, nil)
+	}
+	if loc := headTagPattern.FindIndex(doc); loc != nil {
+		return bytes.Join([][]byte{doc[:loc[1]], tag, doc[loc[1]:]}, nil)
+	}
+	return doc
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewHandler_BasePath(t *testing.T) {
+	staticDir := appDir(t, "main")
+	assert.NoError(t, os.Mkdir(filepath.Join(staticDir, "assets"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(staticDir, "assets", "x.js"), []byte("// x"), 0644))
+
+	config := defaultConfig()
+	config.StaticDir = staticDir
+	config.BasePath = "/portal/"
+	config.Mounts = []Mount{{Prefix: "/admin", StaticDir: appDir(t, "admin")}}
+	handler := NewHandler(config)
+
+	rr := httptestGet(handler, "/portal/assets/x.js")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "// x", rr.Body.String())
+	assert.Equal(t, "public, max-age=31536000, immutable", rr.Header().Get("Cache-Control"))
+
+	rr = httptestGet(handler, "/portal/")
+	assert.Equal(t, "<html>main</html>", rr.Body.String())
+	assert.Equal(t, "no-cache, no-store, must-revalidate", rr.Header().Get("Cache-Control"))
+
+	rr = httptestGet(handler, "/portal/users/1")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "<html>main</html>", rr.Body.String())
+
+	rr = httptestGet(handler, "/portal?ref=home")
+	assert.Equal(t, http.StatusMovedPermanently, rr.Code)
+	assert.Equal(t, "/portal/?ref=home", rr.Header().Get("Location"))
+
+	// The bare mount prefix redirects under the base path
+	rr = httptestGet(handler, "/portal/admin?tab=users")
+	assert.Equal(t, http.StatusMovedPermanently, rr.Code)
+	assert.Equal(t, "/portal/admin/?tab=users", rr.Header().Get("Location"))
+	assert.Equal(t, "<html>admin</html>", httptestGet(handler, "/portal/admin/").Body.String())
+
+	assert.Equal(t, http.StatusNotFound, httptestGet(handler, "/assets/x.js").Code)
+	assert.Equal(t, http.StatusNotFound, httptestGet(handler, "/portalx/").Code)
+	assert.Equal(t, http.StatusOK, httptestGet(handler, "/healthz").Code)
+}
+
+func TestNewHandler_RewriteBaseHref(t *testing.T) {
+	t.Cleanup(func() {
+		for k := range inMemoryCache {
+			delete(inMemoryCache, k)
+		}
+	})
+	staticDir := t.TempDir()
+	index := `<html><head><base href="/"><title>App</title></head></html>`
+	assert.NoError(t, os.WriteFile(filepath.Join(staticDir, "index.html"), []byte(index), 0644))
+	adminDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(adminDir, "index.html"), []byte(`<html><head></head></html>`), 0644))
+
+	config := defaultConfig()
+	config.StaticDir = staticDir
+	config.BasePath = "/portal"
+	config.RewriteBaseHref = true
+	config.Mounts = []Mount{{Prefix: "/admin", StaticDir: adminDir}}
+	handler := NewHandler(config)
+
+	want := `<html><head><base href="/portal/"><title>App</title></head></html>`
+	assert.Equal(t, want, httptestGet(handler, "/portal/").Body.String())
+	assert.Equal(t, want, httptestGet(handler, "/portal/users/1").Body.String())
+	assert.Equal(t, `<html><head><base href="/portal/admin/"></head></html>`, httptestGet(handler, "/portal/admin/users").Body.String())
+
+	// Served from the cache too
+	assert.NoError(t, LoadCriticalAssetsIntoCache(config.StaticDir, config.Mounts...))
+	assert.Equal(t, want, httptestGet(handler, "/portal/").Body.String())
+	assert.Equal(t, `<html><head><base href="/portal/admin/"></head></html>`, httptestGet(handler, "/portal/admin/").Body.String())
+
+	// Without the option the HTML is served as is
+	config.RewriteBaseHref = false
+	assert.Equal(t, index, httptestGet(NewHandler(config), "/portal/users/1").Body.String())
+}
+
+func TestRewriteBaseHref(t *testing.T) {
+	tests := []struct {
+		doc, want string
+	}{
+		{`<head><base href="/"></head>`, `<head><base href="/app/"></head>`},
+		{`<HEAD><BASE HREF='/old/' target="_blank"/></HEAD>`, `<HEAD><base href="/app/"></HEAD>`},
+		{`<head lang="en"><title>x</title></head>`, `<head lang="en"><base href="/app/"><title>x</title></head>`},
+		{`<header></header>`, `<header></header>`},
+		{`<p>no head</p>`, `<p>no head</p>`},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, string(rewriteBaseHref([]byte(tt.doc), "/app/")), tt.doc)
+	}
+}
+
+func TestLoadConfig_BasePath(t *testing.T) {
+	t.Setenv("BASE_PATH", "/portal/")
+	config, err := LoadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "/portal", config.basePath())
+
+	t.Setenv("BASE_PATH", "/")
+	config, err = LoadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "", config.basePath())
+
+	t.Setenv("BASE_PATH", "portal")
+	_, err = LoadConfig()
+	assert.EqualError(t, err, `invalid BASE_PATH "portal": must be a clean absolute path`)
+}
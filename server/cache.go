@@ -1,9 +1,12 @@
 package server
 
 import (
+	"errors"
 	"log"
 	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -12,17 +15,53 @@ type cachedAsset struct {
 	ModTime  time.Time
 	Size     int64
 	MimeType string // To store content type
+	ETag     string // Hash of Content, computed once when it is loaded
 }
 
 var (
+	// cacheMu guards inMemoryCache, which is replaced when the configuration is reloaded.
+	cacheMu       sync.RWMutex
 	inMemoryCache = make(map[string]cachedAsset)
+	// cacheLoaded is set once LoadCriticalAssetsIntoCache has run.
+	cacheLoaded atomic.Bool
 )
 
-// LoadCriticalAssetsIntoCache reads specified critical assets into memory.
-func LoadCriticalAssetsIntoCache(staticDir string) error {
-	// Re-initialize the cache to ensure it's completely empty
-	inMemoryCache = make(map[string]cachedAsset)
+// LoadCriticalAssetsIntoCache reads specified critical assets into memory, for
+// the app in staticDir and for each mounted app. A mounted app's assets are
+// cached under its prefix, e.g. /admin/index.html. Assets that do not exist
+// are skipped, but one that exists and cannot be read is reported as an error.
+// The assets that could be read are cached either way.
+func LoadCriticalAssetsIntoCache(staticDir string, mounts ...Mount) error {
+	cache, err := buildAssetCache(staticDir, mounts...)
+	storeAssetCache(cache)
+	return err
+}
+
+// buildAssetCache reads the critical assets that LoadCriticalAssetsIntoCache
+// caches into a new cache, without swapping it in.
+func buildAssetCache(staticDir string, mounts ...Mount) (map[string]cachedAsset, error) {
+	cache := make(map[string]cachedAsset)
+	errs := []error{loadCriticalAssets(cache, "", staticDir)}
+	for _, m := range mounts {
+		errs = append(errs, loadCriticalAssets(cache, m.pathPrefix(), m.StaticDir))
+	}
+	return cache, errors.Join(errs...)
+}
+
+// storeAssetCache swaps in cache, a complete cache that is not modified
+// afterwards.
+func storeAssetCache(cache map[string]cachedAsset) {
+	cacheMu.Lock()
+	inMemoryCache = cache
+	cacheMu.Unlock()
+	log.Printf("Loaded %d critical assets into in-memory cache.", len(cache))
+	cacheLoaded.Store(true)
+}
 
+// loadCriticalAssets adds the critical assets in staticDir to cache, keyed by
+// their URL path under prefix. It returns the errors for assets that exist but
+// could not be read.
+func loadCriticalAssets(cache map[string]cachedAsset, prefix, staticDir string) error {
 	assetsToCache := []struct {
 		Name     string
 		MimeType string
@@ -31,31 +70,66 @@ func LoadCriticalAssetsIntoCache(staticDir string) error {
 		{"vite.svg", "image/svg+xml"},
 	}
 
+	var errs []error
 	for _, asset := range assetsToCache {
 		filePath := filepath.Join(staticDir, asset.Name)
 		content, err := os.ReadFile(filePath)
 		if err != nil {
 			log.Printf("Warning: Could not load critical asset %s into cache: %v", filePath, err)
+			if !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
 			continue
 		}
 		fileInfo, err := os.Stat(filePath)
 		if err != nil {
 			log.Printf("Warning: Could not get file info for %s: %v", filePath, err)
+			errs = append(errs, err)
 			continue
 		}
-		inMemoryCache["/"+asset.Name] = cachedAsset{
+		cache[prefix+"/"+asset.Name] = cachedAsset{
 			Content:  content,
 			ModTime:  fileInfo.ModTime(),
 			Size:     fileInfo.Size(),
 			MimeType: asset.MimeType,
+			ETag:     contentETag(content),
 		}
 	}
-	log.Printf("Loaded %d critical assets into in-memory cache.", len(inMemoryCache))
-	return nil
+	return errors.Join(errs...)
 }
 
 // GetCachedAsset retrieves a cached asset by its URL path.
 func GetCachedAsset(urlPath string) (cachedAsset, bool) {
+	cacheMu.RLock()
+	defer cacheMu.RUnlock()
 	asset, ok := inMemoryCache[urlPath]
 	return asset, ok
 }
+
+// assetLookup finds a cached asset by its URL path, like GetCachedAsset.
+type assetLookup func(urlPath string) (cachedAsset, bool)
+
+// assetsIn returns a lookup in cache, which must not be modified afterwards.
+// Unlike GetCachedAsset, it keeps answering from cache once another cache is
+// swapped in, so a handler chain built with it serves the assets that were
+// loaded for the config it was built from.
+func assetsIn(cache map[string]cachedAsset) assetLookup {
+	return func(urlPath string) (cachedAsset, bool) {
+		asset, ok := cache[urlPath]
+		return asset, ok
+	}
+}
+
+// currentAssetCache returns the cache that is swapped in.
+func currentAssetCache() map[string]cachedAsset {
+	cacheMu.RLock()
+	defer cacheMu.RUnlock()
+	return inMemoryCache
+}
+
+// cachedAssetCount returns the number of assets in the in-memory cache.
+func cachedAssetCount() int {
+	cacheMu.RLock()
+	defer cacheMu.RUnlock()
+	return len(inMemoryCache)
+}
@@ -9,6 +9,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func init() {
@@ -246,3 +248,95 @@ func TestInMemoryCaching(t *testing.T) {
 		}
 	})
 }
+
+func TestSpaHandler_CachedAssetParity(t *testing.T) {
+	t.Cleanup(func() {
+		for k := range inMemoryCache {
+			delete(inMemoryCache, k)
+		}
+	})
+	staticDir := appDir(t, "main")
+	assert.NoError(t, os.WriteFile(filepath.Join(staticDir, "vite.svg"), []byte("<svg>0123456789</svg>"), 0644))
+	handler := CreateSpaHandler(&Config{StaticDir: staticDir, SpaFallbackFile: "index.html"})
+
+	requests := []struct {
+		name, method, path, rangeHeader string
+	}{
+		{"get", http.MethodGet, "/vite.svg", ""},
+		{"head", http.MethodHead, "/vite.svg", ""},
+		{"range", http.MethodGet, "/vite.svg", "bytes=5-14"},
+		{"suffix range", http.MethodGet, "/vite.svg", "bytes=-6"},
+		{"multiple ranges", http.MethodGet, "/vite.svg", "bytes=0-4,15-"},
+		{"unsatisfiable range", http.MethodGet, "/vite.svg", "bytes=100-"},
+		{"head range", http.MethodHead, "/vite.svg", "bytes=5-14"},
+		{"fallback", http.MethodGet, "/", ""},
+		{"fallback range", http.MethodGet, "/", "bytes=0-5"},
+		{"fallback by name", http.MethodGet, "/index.html", ""},
+	}
+	serve := func(method, path, rangeHeader string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Serve each request from disk, then from the cache, and compare
+	fromDisk := make([]*httptest.ResponseRecorder, len(requests))
+	for i, r := range requests {
+		fromDisk[i] = serve(r.method, r.path, r.rangeHeader)
+	}
+	assert.NoError(t, LoadCriticalAssetsIntoCache(staticDir))
+	for i, r := range requests {
+		t.Run(r.name, func(t *testing.T) {
+			_, cached := GetCachedAsset(r.path)
+			assert.True(t, cached || r.path == "/", "%s is cached", r.path)
+
+			disk, cache := fromDisk[i], serve(r.method, r.path, r.rangeHeader)
+			assert.Equal(t, disk.Code, cache.Code)
+			for _, name := range []string{"Location", "Cache-Control", "Content-Length", "Content-Range", "Accept-Ranges", "ETag", "Last-Modified"} {
+				assert.Equal(t, disk.Header().Get(name), cache.Header().Get(name), name)
+			}
+			if r.method == http.MethodHead {
+				assert.Zero(t, cache.Body.Len())
+			}
+			if !strings.Contains(r.rangeHeader, ",") {
+				assert.Equal(t, disk.Header().Get("Content-Type"), cache.Header().Get("Content-Type"))
+				assert.Equal(t, disk.Body.String(), cache.Body.String())
+			}
+		})
+	}
+
+	// The parts of a multipart response are the same, only the boundary differs
+	rr := serve(http.MethodGet, "/vite.svg", "bytes=0-4,15-")
+	assert.Equal(t, http.StatusPartialContent, rr.Code)
+	assert.True(t, strings.HasPrefix(rr.Header().Get("Content-Type"), "multipart/byteranges; boundary="))
+	assert.Contains(t, rr.Body.String(), "Content-Range: bytes 0-4/21\r\nContent-Type: image/svg+xml\r\n\r\n<svg>\r\n")
+	assert.Contains(t, rr.Body.String(), "Content-Range: bytes 15-20/21\r\nContent-Type: image/svg+xml\r\n\r\n</svg>\r\n")
+
+	rr = serve(http.MethodGet, "/vite.svg", "bytes=100-")
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, rr.Code)
+	assert.Equal(t, "bytes */21", rr.Header().Get("Content-Range"))
+}
+
+func TestLoadCriticalAssetsIntoCache_UnreadableAsset(t *testing.T) {
+	t.Cleanup(func() {
+		for k := range inMemoryCache {
+			delete(inMemoryCache, k)
+		}
+	})
+	staticDir := appDir(t, "main")
+
+	// A missing asset is skipped
+	assert.NoError(t, LoadCriticalAssetsIntoCache(staticDir))
+
+	// One that cannot be read is an error, and the rest is cached anyway
+	assert.NoError(t, os.Mkdir(filepath.Join(staticDir, "vite.svg"), 0755))
+	err := LoadCriticalAssetsIntoCache(staticDir)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "vite.svg")
+	_, ok := GetCachedAsset("/index.html")
+	assert.True(t, ok)
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// defaultCertPollInterval is how often the certificate files are checked for changes.
+const defaultCertPollInterval = 10 * time.Second
+
+// certReloader serves a TLS certificate loaded from disk and reloads it when the
+// certificate or key file changes or SIGHUP is received. A pair that fails to
+// load or validate is rejected and the previous certificate keeps being served.
+type certReloader struct {
+	fileWatcher
+	certFile string
+	keyFile  string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// newCertReloader loads the initial certificate, failing if it is invalid.
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	cr := &certReloader{certFile: certFile, keyFile: keyFile}
+	cr.fileWatcher = newFileWatcher("TLS certificate", defaultCertPollInterval, cr.fileStamp, cr.reload)
+	if err := cr.reload(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	return cr.cert, nil
+}
+
+// reload loads and validates the certificate pair and swaps it in on success.
+func (cr *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading TLS certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("parsing TLS certificate: %v", err)
+	}
+	now := time.Now()
+	if now.After(leaf.NotAfter) {
+		return fmt.Errorf("TLS certificate %s expired at %s", cr.certFile, leaf.NotAfter.Format(time.RFC3339))
+	}
+	if now.Before(leaf.NotBefore) {
+		return fmt.Errorf("TLS certificate %s is not valid before %s", cr.certFile, leaf.NotBefore.Format(time.RFC3339))
+	}
+	cert.Leaf = leaf
+
+	cr.mu.Lock()
+	cr.cert = &cert
+	cr.mu.Unlock()
+
+	log.Printf("Loaded TLS certificate %s for %v (expires %s)", cr.certFile, leaf.DNSNames, leaf.NotAfter.Format(time.RFC3339))
+	return nil
+}
+
+// fileStamp returns a string that changes whenever either file is replaced.
+func (cr *certReloader) fileStamp() string {
+	return filesStamp(cr.certFile, cr.keyFile)
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func currentSerial(t *testing.T, cr *certReloader) string {
+	cert, err := cr.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("GetCertificate failed: %v", err)
+	}
+	return cert.Leaf.SerialNumber.String()
+}
+
+func TestCertReloader_ReloadsChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeSelfSignedCert(t, dir, 24*time.Hour)
+
+	cr, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("newCertReloader failed: %v", err)
+	}
+	original := currentSerial(t, cr)
+
+	// Unchanged files are not reloaded
+	cr.reloadIfChanged()
+	assert.Equal(t, original, currentSerial(t, cr))
+
+	// A rotated certificate is picked up
+	writeSelfSignedCert(t, dir, 48*time.Hour)
+	cr.reloadIfChanged()
+	rotated := currentSerial(t, cr)
+	assert.NotEqual(t, original, rotated)
+
+	// An invalid pair is rejected and the previous certificate is kept
+	assert.NoError(t, os.WriteFile(keyFile, []byte("not a key"), 0600))
+	cr.reloadIfChanged()
+	assert.Equal(t, rotated, currentSerial(t, cr))
+}
+
+func TestCertReloader_RejectsExpiredCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeSelfSignedCert(t, dir, 24*time.Hour)
+
+	cr, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("newCertReloader failed: %v", err)
+	}
+	original := currentSerial(t, cr)
+
+	writeSelfSignedCert(t, dir, -time.Minute)
+	assert.Error(t, cr.reload())
+	assert.Equal(t, original, currentSerial(t, cr))
+
+	_, err = newCertReloader(certFile, keyFile)
+	assert.Error(t, err)
+}
@@ -0,0 +1,38 @@
+//go:build unix
+
+package server
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCertReloader_ReloadsOnSIGHUP(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeSelfSignedCert(t, dir, 24*time.Hour)
+
+	cr, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("newCertReloader failed: %v", err)
+	}
+	cr.interval = time.Hour // Only SIGHUP should trigger the reload
+	original := currentSerial(t, cr)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cr.watch(ctx)
+
+	writeSelfSignedCert(t, dir, 48*time.Hour)
+	assert.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && currentSerial(t, cr) == original {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.NotEqual(t, original, currentSerial(t, cr))
+}
@@ -2,99 +2,505 @@ package server
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"os"
+	"path"
+	"reflect"
 	"strconv" // Added import
 	"strings"
+	"time"
 )
 
+// DefaultShutdownTimeout is how long in-flight requests are given to finish
+// once a shutdown signal has been received.
+const DefaultShutdownTimeout = 30 * time.Second
+
+// DefaultStaticDir is served when no static directory is configured.
+const DefaultStaticDir = "./client/dist"
+
+// Fallback modes, see Config.FallbackMode.
+const (
+	// FallbackNavigation serves the fallback file only for requests that look
+	// like page navigations; missing assets get a 404.
+	FallbackNavigation = "navigation"
+	// FallbackAlways serves the fallback file for every missing path.
+	FallbackAlways = "always"
+)
+
+// profileEnv names the environment variable selecting the config profile.
+const profileEnv = "SPA_PROFILE"
+
+// DefaultConfigFile is read from the working directory when no --config flag is
+// given. YAML and TOML variants of it are also recognised.
+const DefaultConfigFile = ".go-spa-server-config.json"
+
 // Config represents the application configuration.
+//
+// Every field can be set in the config file (json key, also used in YAML and TOML), by an environment
+// variable (env tag) or by a command-line flag named after the json key with
+// dashes, e.g. --static-dir. Flags override environment variables, which
+// override the config file, which overrides the defaults.
 type Config struct {
-	StaticDir       string `json:"static_dir"`
-	SpaFallbackFile string `json:"spa_fallback_file"`
-	Port            int    `json:"port"`
-	CSPHeader       string `json:"csp_header"`
-	HSTSMaxAge          int    `json:"hsts_max_age"`
-	XContentTypeOptions string `json:"x_content_type_options"`
-	XFrameOptions       string `json:"x_frame_options"`
-	ReferrerPolicy      string `json:"referrer_policy"`
-	PermissionsPolicy   string `json:"permissions_policy"`
-}
-
-// LoadConfig loads the configuration from environment variables and a .go-spa-server-config.json file.
-// Environment variables take precedence over the config file.
-func LoadConfig() (*Config, error) {
-	config := &Config{
-		SpaFallbackFile: "index.html", // Default fallback file
-		Port:            8081,         // Default port
+	StaticDir       string `json:"static_dir" env:"STATIC_DIR" desc:"directory containing the built SPA (default ./client/dist)"`
+	SpaFallbackFile string `json:"spa_fallback_file" env:"SPA_FALLBACK_FILE" desc:"file served for client-side routes"`
+	// FallbackMode decides which requests for missing files get the fallback
+	// file: FallbackNavigation or FallbackAlways.
+	FallbackMode string `json:"fallback_mode" env:"FALLBACK_MODE" desc:"which missing paths get the fallback file: navigation (no extension or Accept: text/html) or always"`
+	// FallbackExclude lists path prefixes that never fall back, e.g. /api/.
+	FallbackExclude []string `json:"fallback_exclude" env:"FALLBACK_EXCLUDE" desc:"comma-separated path prefixes that get a 404 instead of the fallback file"`
+	// NotFoundFile, if set, is served with a 404 status for missing files that do
+	// not fall back.
+	NotFoundFile string `json:"not_found_file" env:"NOT_FOUND_FILE" desc:"file in the static directory served with 404 Not Found"`
+	// CleanURLs serves prerendered pages without their .html extension, e.g.
+	// /pricing from pricing.html, before falling back.
+	CleanURLs bool `json:"clean_urls" env:"CLEAN_URLS" desc:"serve /name from name.html and redirect /name/ to /name"`
+
+	Port                int    `json:"port" env:"PORT" desc:"port to listen on"`
+	CSPHeader           string `json:"csp_header" env:"CSP_HEADER" desc:"Content-Security-Policy header value"`
+	HSTSMaxAge          int    `json:"hsts_max_age" env:"HSTS_MAX_AGE" desc:"Strict-Transport-Security max-age in seconds, 0 disables it"`
+	XContentTypeOptions string `json:"x_content_type_options" env:"X_CONTENT_TYPE_OPTIONS" desc:"X-Content-Type-Options header value (default nosniff)"`
+	XFrameOptions       string `json:"x_frame_options" env:"X_FRAME_OPTIONS" desc:"X-Frame-Options header value (default DENY)"`
+	ReferrerPolicy      string `json:"referrer_policy" env:"REFERRER_POLICY" desc:"Referrer-Policy header value (default no-referrer-when-downgrade)"`
+	PermissionsPolicy   string `json:"permissions_policy" env:"PERMISSIONS_POLICY" desc:"Permissions-Policy header value"`
+
+	// ShutdownDelaySeconds is how long to keep serving after SIGTERM while
+	// /healthz reports failure, giving load balancers time to deregister.
+	ShutdownDelaySeconds int `json:"shutdown_delay_seconds" env:"SHUTDOWN_DELAY_SECONDS" desc:"seconds to keep serving after SIGTERM before draining"`
+	// ShutdownTimeoutSeconds bounds how long in-flight requests may drain.
+	ShutdownTimeoutSeconds int `json:"shutdown_timeout_seconds" env:"SHUTDOWN_TIMEOUT_SECONDS" desc:"seconds in-flight requests may take to drain"`
+
+	// TLSCertFile and TLSKeyFile enable HTTPS on Port when both are set.
+	TLSCertFile string `json:"tls_cert_file" env:"TLS_CERT_FILE" desc:"TLS certificate file, enables HTTPS"`
+	TLSKeyFile  string `json:"tls_key_file" env:"TLS_KEY_FILE" desc:"TLS private key file"`
+	// HTTPRedirectPort, if non-zero, serves plain HTTP redirects to HTTPS.
+	HTTPRedirectPort int `json:"http_redirect_port" env:"HTTP_REDIRECT_PORT" desc:"port serving redirects from HTTP to HTTPS"`
+
+	// ACMEDomains enables automatic certificates via ACME for these domains.
+	ACMEDomains      []string `json:"acme_domains" env:"ACME_DOMAINS" desc:"comma-separated domains to obtain ACME certificates for"`
+	ACMEEmail        string   `json:"acme_email" env:"ACME_EMAIL" desc:"contact email for the ACME account"`
+	ACMEDirectoryURL string   `json:"acme_directory_url" env:"ACME_DIRECTORY_URL" desc:"ACME directory URL (default Let's Encrypt)"`
+	ACMECacheDir     string   `json:"acme_cache_dir" env:"ACME_CACHE_DIR" desc:"directory to cache ACME certificates in"`
+	// ACMECACertFile is an extra root CA trusted for the ACME directory.
+	ACMECACertFile string `json:"acme_ca_cert_file" env:"ACME_CA_CERT_FILE" desc:"extra root CA trusted for the ACME directory"`
+
+	// H2C enables cleartext HTTP/2 (prior knowledge and Upgrade) when TLS is off.
+	H2C bool `json:"h2c" env:"H2C" desc:"enable cleartext HTTP/2"`
+
+	// UnixSocket, if set, is the path of a Unix domain socket to listen on instead of Port.
+	UnixSocket string `json:"unix_socket" env:"UNIX_SOCKET" desc:"Unix domain socket to listen on instead of the port"`
+	// UnixSocketMode is the octal file mode applied to the socket, e.g. "0660".
+	UnixSocketMode string `json:"unix_socket_mode" env:"UNIX_SOCKET_MODE" desc:"octal file mode of the Unix socket"`
+	// UnixSocketOwner is the "user:group" the socket is chowned to.
+	UnixSocketOwner string `json:"unix_socket_owner" env:"UNIX_SOCKET_OWNER" desc:"user:group owning the Unix socket"`
+
+	// AdminAddr, if set, is the address of a separate listener for operational
+	// endpoints, e.g. "127.0.0.1:9090". /healthz then moves off the public listener.
+	AdminAddr string `json:"admin_addr" env:"ADMIN_ADDR" desc:"address of the admin listener, e.g. 127.0.0.1:9090"`
+
+	// Mounts serve further SPAs under path prefixes, e.g. an admin app at /admin.
+	Mounts []Mount `json:"mounts" env:"MOUNTS" desc:"SPAs served under path prefixes, as a JSON list of {prefix, static_dir, ...}"`
+
+	// BasePath is the path prefix the server is deployed under, e.g. /portal. It
+	// is stripped from requests before they are routed and files are looked up.
+	BasePath string `json:"base_path" env:"BASE_PATH" desc:"path prefix the server is deployed under, e.g. /portal"`
+	// RewriteBaseHref points <base href> in the served fallback HTML at the base
+	// path (and mount prefix), adding the tag if the document has none.
+	RewriteBaseHref bool `json:"rewrite_base_href" env:"REWRITE_BASE_HREF" desc:"rewrite <base href> in the fallback HTML to where the app is served"`
+
+	// RuntimeEnvPrefix, if set, exposes the environment variables whose names
+	// start with it to the app as window.__ENV__ in the fallback HTML, e.g. "VITE_".
+	RuntimeEnvPrefix string `json:"runtime_env_prefix" env:"RUNTIME_ENV_PREFIX" desc:"expose environment variables with this prefix to the app as window.__ENV__"`
+
+	// RuntimeConfigPath, if set, is a route serving RuntimeConfig and the
+	// environment variables in RuntimeConfigVars to the app, as a script setting
+	// window.__ENV__ for a .js path or as JSON for a .json path.
+	RuntimeConfigPath string `json:"runtime_config_path" env:"RUNTIME_CONFIG_PATH" desc:"route serving runtime config to the app, e.g. /env.js or /config.json"`
+	// RuntimeConfigVars allowlists the environment variables served there. No
+	// other variable is ever exposed.
+	RuntimeConfigVars []string `json:"runtime_config_vars" env:"RUNTIME_CONFIG_VARS" desc:"comma-separated environment variables served at the runtime config path"`
+	// RuntimeConfig holds values served there as they are, usually a section
+	// of the config file.
+	RuntimeConfig map[string]interface{} `json:"runtime_config" env:"RUNTIME_CONFIG" desc:"values served at the runtime config path, as a JSON object"`
+
+	// StrictStartup refuses to start when ValidateConfig reports errors or the
+	// critical assets cannot be cached, instead of logging and carrying on.
+	StrictStartup bool `json:"strict_startup" env:"STRICT_STARTUP" desc:"refuse to start with an invalid configuration"`
+
+	// secretKeys are the keys whose values were read from files named by
+	// NAME_FILE variables. They may be secrets, so they are not shown.
+	secretKeys map[string]bool
+}
+
+// redactedValue is shown instead of the value of a secret key.
+const redactedValue = "<redacted>"
+
+// setSecret records whether the value of key is a secret.
+func (config *Config) setSecret(key string, secret bool) {
+	if !secret {
+		delete(config.secretKeys, key)
+		return
 	}
+	if config.secretKeys == nil {
+		config.secretKeys = make(map[string]bool)
+	}
+	config.secretKeys[key] = true
+}
 
-	// Load from config file if it exists
-	configPath := ".go-spa-server-config.json"
-	if _, err := os.Stat(configPath); err == nil {
-		data, err := os.ReadFile(configPath)
+// configField describes one Config field for the env and flag loaders.
+type configField struct {
+	index int    // field index in Config
+	key   string // json key, also used to name the source in ConfigSources
+	env   string
+	flag  string
+	desc  string
+}
+
+// configFields lists the settable Config fields in declaration order.
+var configFields = func() []configField {
+	t := reflect.TypeOf(Config{})
+	fields := make([]configField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		key := strings.Split(f.Tag.Get("json"), ",")[0]
+		fields = append(fields, configField{
+			index: i,
+			key:   key,
+			env:   f.Tag.Get("env"),
+			flag:  strings.ReplaceAll(key, "_", "-"),
+			desc:  f.Tag.Get("desc"),
+		})
+	}
+	return fields
+}()
+
+// setConfigField parses raw according to the kind of field and stores it.
+// String lists are comma-separated; objects and lists of objects such as
+// mounts are JSON.
+func setConfigField(field reflect.Value, raw string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Int:
+		n, err := strconv.Atoi(raw)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		if err := json.Unmarshal(data, config); err != nil {
-			return nil, err
+		field.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Slice, reflect.Map:
+		if field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String {
+			field.Set(reflect.ValueOf(splitList(raw)))
+			return nil
 		}
+		dec := json.NewDecoder(strings.NewReader(raw))
+		dec.DisallowUnknownFields()
+		dec.UseNumber()
+		return dec.Decode(field.Addr().Interface())
+	default:
+		return fmt.Errorf("unsupported config field type %s", field.Type())
 	}
+	return nil
+}
 
-	// Override with environment variables
-	if staticDirEnv := os.Getenv("STATIC_DIR"); staticDirEnv != "" {
-		config.StaticDir = staticDirEnv
+// Config sources reported by ConfigSources.
+const (
+	sourceDefault = "default"
+	sourceFile    = "file"
+	sourceEnv     = "env"
+	sourceFlag    = "flag"
+)
+
+// ConfigSources maps each config key to where its effective value came from,
+// e.g. "default", "file .go-spa-server-config.json", "env PORT" or "flag --port".
+type ConfigSources map[string]string
+
+// configFlag holds the raw value of a config flag until the config is loaded,
+// so that it can be applied after the file and environment.
+type configFlag struct {
+	typ   reflect.Type
+	value string
+	set   bool
+}
+
+func (f *configFlag) String() string {
+	if f == nil {
+		return ""
 	}
-	if spaFallbackFileEnv := os.Getenv("SPA_FALLBACK_FILE"); spaFallbackFileEnv != "" {
-		config.SpaFallbackFile = spaFallbackFileEnv
+	return f.value
+}
+
+func (f *configFlag) Set(value string) error {
+	// Parse into a scratch value so that flag.Parse reports malformed values.
+	if err := setConfigField(reflect.New(f.typ).Elem(), value); err != nil {
+		return err
 	}
-	// Add port environment variable handling
-	if portEnv := os.Getenv("PORT"); portEnv != "" {
-		p, err := strconv.Atoi(portEnv)
-		if err != nil {
-			return nil, fmt.Errorf("invalid PORT environment variable: %s", portEnv)
+	f.value = value
+	f.set = true
+	return nil
+}
+
+// IsBoolFlag lets boolean settings be given as a bare --name.
+func (f *configFlag) IsBoolFlag() bool {
+	return f.typ.Kind() == reflect.Bool
+}
+
+// stringList is a flag.Value collecting the values of a repeated flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// ConfigFlags are the command-line flags for every Config field plus --config
+// and --profile. Create them with RegisterConfigFlags and call Load after parsing.
+type ConfigFlags struct {
+	configFiles stringList
+	profile     string
+	values      map[string]*configFlag // keyed by config key
+}
+
+// RegisterConfigFlags defines --config, --profile and one flag per Config field on fs.
+func RegisterConfigFlags(fs *flag.FlagSet) *ConfigFlags {
+	f := &ConfigFlags{values: make(map[string]*configFlag)}
+	fs.Var(&f.configFiles, "config", "path to a JSON, YAML or TOML config file, repeat to merge several in order (default "+DefaultConfigFile+" if present)")
+	fs.StringVar(&f.profile, "profile", "", "profile whose overlays to apply from the config files [$"+profileEnv+"]")
+
+	t := reflect.TypeOf(Config{})
+	for _, field := range configFields {
+		value := &configFlag{typ: t.Field(field.index).Type}
+		f.values[field.key] = value
+		usage := field.desc
+		if field.env != "" {
+			usage += " [$" + field.env + "]"
 		}
-		config.Port = p
+		fs.Var(value, field.flag, usage)
 	}
+	return f
+}
+
+// defaultConfig returns the configuration used when nothing is set.
+func defaultConfig() *Config {
+	return &Config{
+		SpaFallbackFile: "index.html", // Default fallback file
+		FallbackMode:    FallbackNavigation,
+		Port:            8081, // Default port
+
+		ShutdownTimeoutSeconds: int(DefaultShutdownTimeout / time.Second),
+	}
+}
 
-	// Load CSPHeader from environment variable
-	if cspHeaderEnv := os.Getenv("CSP_HEADER"); cspHeaderEnv != "" {
-		config.CSPHeader = cspHeaderEnv
+// LoadConfig loads the configuration from environment variables and a .go-spa-server-config.json
+// (or .yaml, .yml, .toml) file. Environment variables take precedence over the config file.
+func LoadConfig() (*Config, error) {
+	config, _, err := (&ConfigFlags{}).Load()
+	return config, err
+}
+
+// Load builds the configuration from the defaults, the config file, the
+// environment and the parsed flags, in increasing order of precedence, and
+// reports where each value came from. f may be an empty ConfigFlags, in which
+// case only the default config file and the environment are consulted.
+func (f *ConfigFlags) Load() (*Config, ConfigSources, error) {
+	config := defaultConfig()
+	sources := make(ConfigSources, len(configFields))
+	for _, field := range configFields {
+		sources[field.key] = sourceDefault
+	}
+	v := reflect.ValueOf(config).Elem()
+
+	// Load from the config files, if any, with the selected profile applied.
+	// Files given with --config must exist.
+	configPaths, err := f.configPaths()
+	if err != nil {
+		return nil, nil, err
+	}
+	profile := f.profile
+	if profile == "" {
+		profile = os.Getenv(profileEnv)
+	}
+	if err := loadConfigFiles(configPaths, profile, config, sources); err != nil {
+		return nil, nil, err
 	}
 
-	// Load HSTSMaxAge from environment variable
-	if hstsMaxAgeEnv := os.Getenv("HSTS_MAX_AGE"); hstsMaxAgeEnv != "" {
-		h, err := strconv.Atoi(hstsMaxAgeEnv)
+	// Override with environment variables, or files named by NAME_FILE
+	for _, field := range configFields {
+		if field.env == "" {
+			continue
+		}
+		raw, name, err := lookupEnv(field.env)
 		if err != nil {
-			return nil, fmt.Errorf("invalid HSTS_MAX_AGE environment variable: %s", hstsMaxAgeEnv)
+			return nil, nil, err
+		}
+		if raw == "" {
+			continue
+		}
+		if err := setConfigField(v.Field(field.index), raw); err != nil {
+			if name != field.env {
+				// Don't echo the contents of what may be a secret
+				return nil, nil, fmt.Errorf("invalid value in the file named by %s", name)
+			}
+			return nil, nil, fmt.Errorf("invalid %s environment variable: %s", field.env, raw)
 		}
-		config.HSTSMaxAge = h
+		sources[field.key] = sourceEnv + " " + name
+		config.setSecret(field.key, name != field.env)
 	}
 
-	// Load XContentTypeOptions from environment variable
-	if xContentTypeOptionsEnv := os.Getenv("X_CONTENT_TYPE_OPTIONS"); xContentTypeOptionsEnv != "" {
-		config.XContentTypeOptions = xContentTypeOptionsEnv
+	// Override with command-line flags
+	for _, field := range configFields {
+		value := f.values[field.key]
+		if value == nil || !value.set {
+			continue
+		}
+		if err := setConfigField(v.Field(field.index), value.value); err != nil {
+			return nil, nil, fmt.Errorf("invalid value %q for flag --%s: %v", value.value, field.flag, err)
+		}
+		sources[field.key] = sourceFlag + " --" + field.flag
+		config.setSecret(field.key, false)
 	}
 
-	// Load XFrameOptions from environment variable
-	if xFrameOptionsEnv := os.Getenv("X_FRAME_OPTIONS"); xFrameOptionsEnv != "" {
-		config.XFrameOptions = xFrameOptionsEnv
+	if err := config.validate(); err != nil {
+		return nil, nil, err
 	}
+	return config, sources, nil
+}
 
-	// Load ReferrerPolicy from environment variable
-	if referrerPolicyEnv := os.Getenv("REFERRER_POLICY"); referrerPolicyEnv != "" {
-		config.ReferrerPolicy = referrerPolicyEnv
+// lookupEnv returns the value of the environment variable name or, if
+// name_FILE is set instead, the contents of the file it names with a trailing
+// newline removed. This is how secrets mounted as files are passed in. The
+// variable the value came from is returned too.
+func lookupEnv(name string) (value, source string, err error) {
+	fileName := os.Getenv(name + "_FILE")
+	if fileName == "" {
+		return os.Getenv(name), name, nil
+	}
+	if os.Getenv(name) != "" {
+		return "", "", fmt.Errorf("%s and %s_FILE cannot both be set", name, name)
+	}
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return "", "", fmt.Errorf("reading %s_FILE: %v", name, err)
+	}
+	value = strings.TrimSuffix(string(data), "\n")
+	return strings.TrimSuffix(value, "\r"), name + "_FILE", nil
+}
+
+// configPaths returns the config files to load: those given with --config, or
+// else the default config file in the working directory, if there is one.
+func (f *ConfigFlags) configPaths() ([]string, error) {
+	if len(f.configFiles) > 0 {
+		return f.configFiles, nil
+	}
+	path, err := findDefaultConfigFile()
+	if err != nil || path == "" {
+		return nil, err
 	}
+	return []string{path}, nil
+}
 
-	// Load PermissionsPolicy from environment variable
-	if permissionsPolicyEnv := os.Getenv("PERMISSIONS_POLICY"); permissionsPolicyEnv != "" {
-		config.PermissionsPolicy = permissionsPolicyEnv
+// StaticDirOrDefault returns the configured static directory or DefaultStaticDir.
+func (c *Config) StaticDirOrDefault() string {
+	if c.StaticDir == "" {
+		return DefaultStaticDir
 	}
+	return c.StaticDir
+}
 
+// validate rejects settings that LoadConfig cannot make sense of. See
+// ValidateConfig for checks against the environment the server runs in.
+func (config *Config) validate() error {
 	// Basic validation for SpaFallbackFile
 	if config.SpaFallbackFile == "" || strings.ContainsAny(config.SpaFallbackFile, "/\\") {
-		return nil, fmt.Errorf("invalid SPA_FALLBACK_FILE: %s", config.SpaFallbackFile)
+		return fmt.Errorf("invalid SPA_FALLBACK_FILE: %s", config.SpaFallbackFile)
+	}
+
+	if config.FallbackMode != "" && config.FallbackMode != FallbackNavigation && config.FallbackMode != FallbackAlways {
+		return fmt.Errorf("invalid FALLBACK_MODE: %s, expected %s or %s", config.FallbackMode, FallbackNavigation, FallbackAlways)
+	}
+	if strings.ContainsAny(config.NotFoundFile, "/\\") {
+		return fmt.Errorf("invalid NOT_FOUND_FILE: %s", config.NotFoundFile)
+	}
+
+	// The certificate and key must be configured together
+	if (config.TLSCertFile == "") != (config.TLSKeyFile == "") {
+		return fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if config.ACMEEnabled() && config.TLSCertFile != "" {
+		return fmt.Errorf("ACME_DOMAINS cannot be combined with TLS_CERT_FILE and TLS_KEY_FILE")
+	}
+	if config.UnixSocketMode != "" {
+		if _, err := strconv.ParseUint(config.UnixSocketMode, 8, 32); err != nil {
+			return fmt.Errorf("invalid UNIX_SOCKET_MODE: %s", config.UnixSocketMode)
+		}
+	}
+	if config.H2C && config.TLSEnabled() {
+		return fmt.Errorf("H2C cannot be combined with TLS, HTTP/2 is negotiated automatically over TLS")
+	}
+	if config.HTTPRedirectPort != 0 && !config.TLSEnabled() {
+		return fmt.Errorf("HTTP_REDIRECT_PORT requires TLS_CERT_FILE and TLS_KEY_FILE or ACME_DOMAINS")
+	}
+	if config.RuntimeConfigPath != "" {
+		ext := path.Ext(config.RuntimeConfigPath)
+		if checkPathPrefix(config.RuntimeConfigPath) != nil || (ext != ".js" && ext != ".json") {
+			return fmt.Errorf("invalid RUNTIME_CONFIG_PATH: %s, expected a path ending in .js or .json", config.RuntimeConfigPath)
+		}
+		// Both would be routed at the same pattern
+		for _, m := range config.Mounts {
+			if m.pathPrefix() == config.RuntimeConfigPath {
+				return fmt.Errorf("RUNTIME_CONFIG_PATH %s conflicts with mount prefix %q", config.RuntimeConfigPath, m.Prefix)
+			}
+		}
+	}
+	if basePath := config.basePath(); basePath != "" {
+		if err := checkPathPrefix(basePath); err != nil {
+			return fmt.Errorf("invalid BASE_PATH %q: %v", config.BasePath, err)
+		}
 	}
+	return validateMounts(config.Mounts)
+}
 
-	return config, nil
+// PrintConfig writes the effective configuration, one key per line, with the
+// source of each value as a trailing comment. Values read from files named by
+// NAME_FILE variables are redacted.
+func PrintConfig(w io.Writer, config *Config, sources ConfigSources) {
+	v := reflect.ValueOf(config).Elem()
+	width := 0
+	for _, field := range configFields {
+		if len(field.key) > width {
+			width = len(field.key)
+		}
+	}
+	for _, field := range configFields {
+		value, _ := json.Marshal(v.Field(field.index).Interface())
+		if config.secretKeys[field.key] {
+			value = []byte(redactedValue)
+		}
+		fmt.Fprintf(w, "%-*s = %-24s # %s\n", width, field.key, value, sources[field.key])
+	}
+}
+
+// splitList splits a comma-separated environment variable value into its
+// trimmed, non-empty elements.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
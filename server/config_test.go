@@ -1,6 +1,9 @@
 package server
 
 import (
+	"bytes"
+	"flag"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
@@ -278,3 +281,263 @@ func TestLoadConfig_DefaultCSPAndHSTS(t *testing.T) {
 	assert.Equal(t, "", config.CSPHeader)
 	assert.Equal(t, 0, config.HSTSMaxAge)
 }
+
+func TestLoadConfig_ShutdownSettings(t *testing.T) {
+	tempDir := t.TempDir()
+	originalDir, _ := os.Getwd()
+	defer os.Chdir(originalDir)
+	err := os.Chdir(tempDir)
+	assert.NoError(t, err)
+
+	config, err := LoadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, config.ShutdownDelaySeconds)
+	assert.Equal(t, 30, config.ShutdownTimeoutSeconds)
+
+	t.Setenv("SHUTDOWN_DELAY_SECONDS", "5")
+	t.Setenv("SHUTDOWN_TIMEOUT_SECONDS", "60")
+
+	config, err = LoadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, 5, config.ShutdownDelaySeconds)
+	assert.Equal(t, 60, config.ShutdownTimeoutSeconds)
+
+	t.Setenv("SHUTDOWN_TIMEOUT_SECONDS", "soon")
+
+	config, err = LoadConfig()
+	assert.Error(t, err)
+	assert.Nil(t, config)
+}
+
+func TestLoadConfig_TLSSettings(t *testing.T) {
+	tempDir := t.TempDir()
+	originalDir, _ := os.Getwd()
+	defer os.Chdir(originalDir)
+	err := os.Chdir(tempDir)
+	assert.NoError(t, err)
+
+	t.Setenv("TLS_CERT_FILE", "/etc/tls/tls.crt")
+	t.Setenv("TLS_KEY_FILE", "/etc/tls/tls.key")
+	t.Setenv("HTTP_REDIRECT_PORT", "8080")
+
+	config, err := LoadConfig()
+	assert.NoError(t, err)
+	assert.True(t, config.TLSEnabled())
+	assert.Equal(t, "/etc/tls/tls.crt", config.TLSCertFile)
+	assert.Equal(t, "/etc/tls/tls.key", config.TLSKeyFile)
+	assert.Equal(t, 8080, config.HTTPRedirectPort)
+
+	t.Setenv("TLS_KEY_FILE", "")
+
+	config, err = LoadConfig()
+	assert.Error(t, err) // Certificate without key
+	assert.Nil(t, config)
+
+	t.Setenv("TLS_CERT_FILE", "")
+
+	config, err = LoadConfig()
+	assert.Error(t, err) // Redirect listener without TLS
+	assert.Nil(t, config)
+}
+
+func TestLoadConfig_ACMESettings(t *testing.T) {
+	tempDir := t.TempDir()
+	originalDir, _ := os.Getwd()
+	defer os.Chdir(originalDir)
+	err := os.Chdir(tempDir)
+	assert.NoError(t, err)
+
+	t.Setenv("ACME_DOMAINS", "example.com, www.example.com")
+	t.Setenv("ACME_EMAIL", "ops@example.com")
+	t.Setenv("ACME_DIRECTORY_URL", "https://localhost:14000/dir")
+	t.Setenv("ACME_CACHE_DIR", "/var/cache/acme")
+	t.Setenv("HTTP_REDIRECT_PORT", "80")
+
+	config, err := LoadConfig()
+	assert.NoError(t, err)
+	assert.True(t, config.ACMEEnabled())
+	assert.True(t, config.TLSEnabled())
+	assert.Equal(t, []string{"example.com", "www.example.com"}, config.ACMEDomains)
+	assert.Equal(t, "ops@example.com", config.ACMEEmail)
+	assert.Equal(t, "https://localhost:14000/dir", config.ACMEDirectoryURL)
+	assert.Equal(t, "/var/cache/acme", config.ACMECacheDir)
+	assert.Equal(t, 80, config.HTTPRedirectPort)
+
+	t.Setenv("TLS_CERT_FILE", "/etc/tls/tls.crt")
+	t.Setenv("TLS_KEY_FILE", "/etc/tls/tls.key")
+
+	config, err = LoadConfig()
+	assert.Error(t, err) // ACME and static certificates are mutually exclusive
+	assert.Nil(t, config)
+}
+
+func TestLoadConfig_StrictStartup(t *testing.T) {
+	tempDir := t.TempDir()
+	originalDir, _ := os.Getwd()
+	defer os.Chdir(originalDir)
+	err := os.Chdir(tempDir)
+	assert.NoError(t, err)
+
+	config, err := LoadConfig()
+	assert.NoError(t, err)
+	assert.False(t, config.StrictStartup)
+
+	t.Setenv("STRICT_STARTUP", "true")
+	config, err = LoadConfig()
+	assert.NoError(t, err)
+	assert.True(t, config.StrictStartup)
+
+	t.Setenv("STRICT_STARTUP", "always")
+	config, err = LoadConfig()
+	assert.Error(t, err)
+	assert.Nil(t, config)
+}
+
+func TestLoadConfig_FallbackSettings(t *testing.T) {
+	tempDir := t.TempDir()
+	originalDir, _ := os.Getwd()
+	defer os.Chdir(originalDir)
+	err := os.Chdir(tempDir)
+	assert.NoError(t, err)
+
+	config, err := LoadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, FallbackNavigation, config.FallbackMode)
+	assert.Empty(t, config.FallbackExclude)
+
+	t.Setenv("FALLBACK_MODE", "always")
+	t.Setenv("FALLBACK_EXCLUDE", "/api/, /static/")
+	t.Setenv("NOT_FOUND_FILE", "404.html")
+	config, err = LoadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, FallbackAlways, config.FallbackMode)
+	assert.Equal(t, []string{"/api/", "/static/"}, config.FallbackExclude)
+	assert.Equal(t, "404.html", config.NotFoundFile)
+
+	t.Setenv("FALLBACK_MODE", "sometimes")
+	_, err = LoadConfig()
+	assert.EqualError(t, err, "invalid FALLBACK_MODE: sometimes, expected navigation or always")
+
+	t.Setenv("FALLBACK_MODE", "")
+	t.Setenv("NOT_FOUND_FILE", "errors/404.html")
+	_, err = LoadConfig()
+	assert.EqualError(t, err, "invalid NOT_FOUND_FILE: errors/404.html")
+}
+
+func TestConfigFlags_Precedence(t *testing.T) {
+	tempDir := t.TempDir()
+	originalDir, _ := os.Getwd()
+	defer os.Chdir(originalDir)
+	err := os.Chdir(tempDir)
+	assert.NoError(t, err)
+
+	// The default config file is ignored once --config points elsewhere.
+	assert.NoError(t, os.WriteFile(DefaultConfigFile, []byte(`{"csp_header": "default-src 'none'"}`), 0644))
+	assert.NoError(t, os.WriteFile("custom.json", []byte(`{"static_dir": "./file_static", "port": 9000, "hsts_max_age": 60}`), 0644))
+	t.Setenv("STATIC_DIR", "./env_static")
+	t.Setenv("PORT", "9001")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := RegisterConfigFlags(fs)
+	assert.NoError(t, fs.Parse([]string{"--config", "custom.json", "--static-dir", "./flag_static", "--acme-domains", "a.example.com, b.example.com"}))
+
+	config, sources, err := flags.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "./flag_static", config.StaticDir)
+	assert.Equal(t, 9001, config.Port)
+	assert.Equal(t, 60, config.HSTSMaxAge)
+	assert.Equal(t, "", config.CSPHeader)
+	assert.Equal(t, "index.html", config.SpaFallbackFile)
+	assert.Equal(t, []string{"a.example.com", "b.example.com"}, config.ACMEDomains)
+
+	assert.Equal(t, "flag --static-dir", sources["static_dir"])
+	assert.Equal(t, "env PORT", sources["port"])
+	assert.Equal(t, "file custom.json", sources["hsts_max_age"])
+	assert.Equal(t, "default", sources["spa_fallback_file"])
+
+	// Validation still applies to values set by flags.
+	assert.NoError(t, fs.Set("h2c", "true"))
+	_, _, err = flags.Load()
+	assert.Error(t, err)
+}
+
+func TestConfigFlags_InvalidValues(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	RegisterConfigFlags(fs)
+	assert.Error(t, fs.Parse([]string{"--port", "http"}))
+	assert.Error(t, fs.Parse([]string{"--h2c=maybe"}))
+}
+
+func TestConfigFlags_MissingConfigFile(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := RegisterConfigFlags(fs)
+	assert.NoError(t, fs.Parse([]string{"--config", filepath.Join(t.TempDir(), "missing.json")}))
+
+	config, _, err := flags.Load()
+	assert.Error(t, err)
+	assert.Nil(t, config)
+}
+
+func TestLoadConfig_EnvFromFile(t *testing.T) {
+	tempDir := t.TempDir()
+	originalDir, _ := os.Getwd()
+	defer os.Chdir(originalDir)
+	err := os.Chdir(tempDir)
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.WriteFile("csp", []byte("default-src 'self'\n"), 0600))
+	assert.NoError(t, os.WriteFile("port", []byte("9000\r\n"), 0600))
+	t.Setenv("CSP_HEADER_FILE", filepath.Join(tempDir, "csp"))
+	t.Setenv("PORT_FILE", "port")
+
+	config, sources, err := (&ConfigFlags{}).Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "default-src 'self'", config.CSPHeader)
+	assert.Equal(t, 9000, config.Port)
+	assert.Equal(t, "env CSP_HEADER_FILE", sources["csp_header"])
+
+	// The variable and its _FILE variant are mutually exclusive.
+	t.Setenv("PORT", "9001")
+	_, err = LoadConfig()
+	assert.EqualError(t, err, "PORT and PORT_FILE cannot both be set")
+	t.Setenv("PORT", "")
+
+	t.Setenv("CSP_HEADER_FILE", filepath.Join(tempDir, "missing"))
+	_, err = LoadConfig()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "reading CSP_HEADER_FILE")
+	}
+	t.Setenv("CSP_HEADER_FILE", "")
+
+	// Invalid values from files are reported without their contents.
+	assert.NoError(t, os.WriteFile("port", []byte("s3cr3t"), 0600))
+	_, err = LoadConfig()
+	if assert.Error(t, err) {
+		assert.Equal(t, "invalid value in the file named by PORT_FILE", err.Error())
+	}
+}
+
+func TestPrintConfig_RedactsSecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "csp"), []byte("default-src 's3cr3t'"), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "email"), []byte("ops@s3cr3t.example"), 0600))
+	t.Setenv("CSP_HEADER_FILE", filepath.Join(dir, "csp"))
+	t.Setenv("ACME_EMAIL_FILE", filepath.Join(dir, "email"))
+	t.Setenv("STATIC_DIR", "./env_static")
+
+	// A flag overrides the secret, so its value is shown again
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := RegisterConfigFlags(fs)
+	assert.NoError(t, fs.Parse([]string{"--acme-email", "ops@example.com"}))
+	config, sources, err := flags.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "default-src 's3cr3t'", config.CSPHeader)
+
+	var out bytes.Buffer
+	PrintConfig(&out, config, sources)
+	assert.NotContains(t, out.String(), "s3cr3t")
+	assert.Regexp(t, `(?m)^csp_header += <redacted> +# env CSP_HEADER_FILE$`, out.String())
+	assert.Regexp(t, `(?m)^acme_email += "ops@example.com" +# flag --acme-email$`, out.String())
+	assert.Regexp(t, `(?m)^static_dir += "./env_static" +# env STATIC_DIR$`, out.String())
+}
@@ -0,0 +1,556 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+	"gopkg.in/yaml.v3"
+)
+
+// profilesKey is the config file section holding the per-profile overlays.
+const profilesKey = "profiles"
+
+// schemaKey may name the file's JSON Schema for editors. The server ignores it.
+const schemaKey = "$schema"
+
+// defaultConfigFiles are looked for in the working directory, in this order,
+// when no --config flag is given. At most one of them may exist.
+var defaultConfigFiles = []string{
+	DefaultConfigFile,
+	".go-spa-server-config.yaml",
+	".go-spa-server-config.yml",
+	".go-spa-server-config.toml",
+}
+
+// findDefaultConfigFile returns the default config file present in the working
+// directory, or "" if there is none.
+func findDefaultConfigFile() (string, error) {
+	var found []string
+	for _, name := range defaultConfigFiles {
+		if _, err := os.Stat(name); err == nil {
+			found = append(found, name)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", nil
+	case 1:
+		return found[0], nil
+	default:
+		return "", fmt.Errorf("found several config files (%s), use --config to choose one", strings.Join(found, ", "))
+	}
+}
+
+// filePosition is a 1-based line and column in a config file.
+type filePosition struct {
+	line, column int
+}
+
+// positionAt converts a byte offset in data to a line and column.
+func positionAt(data []byte, offset int) filePosition {
+	if offset > len(data) {
+		offset = len(data)
+	} else if offset < 0 {
+		offset = 0
+	}
+	lead := data[:offset]
+	return filePosition{
+		line:   bytes.Count(lead, []byte{'\n'}) + 1,
+		column: len(lead) - bytes.LastIndexByte(lead, '\n'),
+	}
+}
+
+// configDocument is a config file decoded into its top-level keys, with the
+// raw JSON encoding of each value. positions holds where each key starts,
+// keyed by its dotted path such as "port" or "profiles.prod.port"; keys inside
+// lists are not tracked.
+type configDocument struct {
+	path      string
+	values    map[string]json.RawMessage
+	positions map[string]filePosition
+}
+
+// errorf formats an error about the key at path in the document, prefixed with its position.
+func (d *configDocument) errorf(path, format string, args ...interface{}) error {
+	pos := d.positions[path]
+	return fmt.Errorf("%s:%d:%d: %s", d.path, pos.line, pos.column, fmt.Sprintf(format, args...))
+}
+
+// recordPosition records where the key at path starts, keeping the first occurrence.
+func (d *configDocument) recordPosition(path []string, pos filePosition) {
+	key := strings.Join(path, ".")
+	if _, ok := d.positions[key]; !ok {
+		d.positions[key] = pos
+	}
+}
+
+// parseConfigFile decodes a JSON, YAML or TOML config file, chosen by the file
+// extension. Anything other than .yaml, .yml or .toml is read as JSON.
+func parseConfigFile(path string, data []byte) (*configDocument, error) {
+	doc := &configDocument{
+		path:      path,
+		values:    make(map[string]json.RawMessage),
+		positions: make(map[string]filePosition),
+	}
+
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = doc.parseYAML(data)
+	case ".toml":
+		err = doc.parseTOML(data)
+	default:
+		err = doc.parseJSON(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (d *configDocument) parseJSON(data []byte) error {
+	if err := json.Unmarshal(data, &d.values); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			// Offset is just past the offending character.
+			pos := positionAt(data, int(syntaxErr.Offset)-1)
+			return fmt.Errorf("%s:%d:%d: %v", d.path, pos.line, pos.column, err)
+		}
+		return fmt.Errorf("%s: %v", d.path, err)
+	}
+
+	// Walk the tokens to find where each key starts.
+	type level struct {
+		object    bool
+		expectKey bool
+		key       string
+	}
+	var stack []level
+	valueDone := func() {
+		if n := len(stack); n > 0 && stack[n-1].object {
+			stack[n-1].expectKey = true
+		}
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		offset := int(dec.InputOffset())
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		if delim, ok := tok.(json.Delim); ok {
+			switch delim {
+			case '{', '[':
+				stack = append(stack, level{object: delim == '{', expectKey: delim == '{'})
+			default:
+				stack = stack[:len(stack)-1]
+				valueDone()
+			}
+			continue
+		}
+		n := len(stack)
+		if n == 0 || !stack[n-1].object || !stack[n-1].expectKey {
+			valueDone()
+			continue
+		}
+
+		stack[n-1].key = tok.(string)
+		stack[n-1].expectKey = false
+		path := make([]string, 0, n)
+		for _, l := range stack {
+			if !l.object {
+				path = nil // inside a list
+				break
+			}
+			path = append(path, l.key)
+		}
+		if path != nil {
+			// Skip the separator and whitespace preceding the key.
+			for offset < len(data) && strings.IndexByte(" \t\r\n,", data[offset]) >= 0 {
+				offset++
+			}
+			d.recordPosition(path, positionAt(data, offset))
+		}
+	}
+	return nil
+}
+
+func (d *configDocument) parseYAML(data []byte) error {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return fmt.Errorf("%s: %v", d.path, err)
+	}
+	if root.Kind == 0 {
+		return nil // empty document
+	}
+	mapping := root.Content[0]
+	if mapping.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s:%d:%d: expected a mapping of config keys", d.path, mapping.Line, mapping.Column)
+	}
+	d.recordYAMLPositions(mapping, nil)
+
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		keyNode, valueNode := mapping.Content[i], mapping.Content[i+1]
+		var value interface{}
+		if err := valueNode.Decode(&value); err != nil {
+			return d.errorf(keyNode.Value, "%v", err)
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return d.errorf(keyNode.Value, "%v", err)
+		}
+		d.values[keyNode.Value] = raw
+	}
+	return nil
+}
+
+// recordYAMLPositions records the positions of the keys of a mapping node and
+// of the mappings nested in it.
+func (d *configDocument) recordYAMLPositions(mapping *yaml.Node, prefix []string) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		keyNode, valueNode := mapping.Content[i], mapping.Content[i+1]
+		path := append(append([]string(nil), prefix...), keyNode.Value)
+		d.recordPosition(path, filePosition{line: keyNode.Line, column: keyNode.Column})
+		if valueNode.Kind == yaml.MappingNode {
+			d.recordYAMLPositions(valueNode, path)
+		}
+	}
+}
+
+func (d *configDocument) parseTOML(data []byte) error {
+	var values map[string]interface{}
+	if err := toml.Unmarshal(data, &values); err != nil {
+		var decodeErr *toml.DecodeError
+		if errors.As(err, &decodeErr) {
+			line, column := decodeErr.Position()
+			return fmt.Errorf("%s:%d:%d: %v", d.path, line, column, err)
+		}
+		return fmt.Errorf("%s: %v", d.path, err)
+	}
+	for key, value := range values {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %v", d.path, key, err)
+		}
+		d.values[key] = raw
+	}
+
+	// The document is valid, so parse it again only to locate the keys. Keys
+	// below a table header belong to that table; keys in arrays of tables are
+	// not tracked.
+	p := unstable.Parser{}
+	p.Reset(data)
+	var table []string
+	inArray := false
+	for p.NextExpression() {
+		expr := p.Expression()
+		var path []string
+		switch expr.Kind {
+		case unstable.Table, unstable.ArrayTable:
+			table, inArray = nil, expr.Kind == unstable.ArrayTable
+		case unstable.KeyValue:
+			if inArray {
+				continue
+			}
+			path = append(path, table...)
+		default:
+			continue
+		}
+		for keys := expr.Key(); keys.Next(); {
+			key := keys.Node()
+			path = append(path, string(key.Data))
+			start := p.Shape(key.Raw).Start
+			d.recordPosition(path, filePosition{line: start.Line, column: start.Column})
+		}
+		if expr.Kind != unstable.KeyValue {
+			table = path
+		}
+	}
+	return nil
+}
+
+// sortedByPosition returns paths ordered by where they appear in the document.
+func (d *configDocument) sortedByPosition(paths []string) []string {
+	sort.Slice(paths, func(i, j int) bool {
+		a, b := d.positions[paths[i]], d.positions[paths[j]]
+		if a.line != b.line {
+			return a.line < b.line
+		}
+		return a.column < b.column
+	})
+	return paths
+}
+
+// configLayer is one set of settings from a config file: its top level or
+// one of its profiles.
+type configLayer struct {
+	doc    *configDocument
+	prefix string // dotted path of the settings in doc, "" for the top level
+	source string
+	values map[string]json.RawMessage
+}
+
+// layers splits the document into its top-level settings and, if it defines
+// the given profile, that profile's overlay. Keys that are not config fields
+// are rejected, in every profile and not just the selected one.
+func (d *configDocument) layers(profile string) ([]configLayer, error) {
+	top := configLayer{doc: d, source: sourceFile + " " + d.path, values: make(map[string]json.RawMessage)}
+	var unknown []string
+	for key, raw := range d.values {
+		switch {
+		case key == profilesKey, key == schemaKey:
+		case isConfigKey(key):
+			top.values[key] = raw
+		default:
+			unknown = append(unknown, key)
+		}
+	}
+
+	var profiles map[string]map[string]json.RawMessage
+	if raw, ok := d.values[profilesKey]; ok {
+		if err := json.Unmarshal(raw, &profiles); err != nil {
+			return nil, d.errorf(profilesKey, "%s must map profile names to settings", profilesKey)
+		}
+		for name, values := range profiles {
+			for key := range values {
+				if !isConfigKey(key) {
+					unknown = append(unknown, profilesKey+"."+name+"."+key)
+				}
+			}
+		}
+	}
+
+	if len(unknown) > 0 {
+		errs := make([]error, len(unknown))
+		for i, path := range d.sortedByPosition(unknown) {
+			errs[i] = d.errorf(path, "unknown config key %q", path)
+		}
+		return nil, errors.Join(errs...)
+	}
+
+	layers := []configLayer{top}
+	if values, ok := profiles[profile]; ok && profile != "" {
+		layers = append(layers, configLayer{
+			doc:    d,
+			prefix: profilesKey + "." + profile + ".",
+			source: fmt.Sprintf("%s %s (profile %s)", sourceFile, d.path, profile),
+			values: values,
+		})
+	}
+	return layers, nil
+}
+
+func isConfigKey(key string) bool {
+	for _, field := range configFields {
+		if field.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeJSON overlays one JSON value on another. Objects are merged key by key,
+// recursively; anything else in overlay replaces base.
+func mergeJSON(base, overlay json.RawMessage) json.RawMessage {
+	var baseObject, overlayObject map[string]json.RawMessage
+	if json.Unmarshal(base, &baseObject) != nil || json.Unmarshal(overlay, &overlayObject) != nil ||
+		baseObject == nil || overlayObject == nil {
+		return overlay
+	}
+	for key, value := range overlayObject {
+		if existing, ok := baseObject[key]; ok {
+			value = mergeJSON(existing, value)
+		}
+		baseObject[key] = value
+	}
+	merged, err := json.Marshal(baseObject)
+	if err != nil {
+		return overlay
+	}
+	return merged
+}
+
+// applyConfigLayers merges the layers in order, later layers overriding
+// earlier ones, then sets the fields of config from the result and records
+// where each value came from.
+func applyConfigLayers(layers []configLayer, config *Config, sources ConfigSources) error {
+	type setting struct {
+		raw   json.RawMessage
+		layer configLayer
+	}
+	merged := make(map[string]setting)
+	for _, layer := range layers {
+		for key, raw := range layer.values {
+			if previous, ok := merged[key]; ok {
+				raw = mergeJSON(previous.raw, raw)
+			}
+			merged[key] = setting{raw: raw, layer: layer}
+		}
+	}
+
+	v := reflect.ValueOf(config).Elem()
+	for _, field := range configFields {
+		s, ok := merged[field.key]
+		if !ok {
+			continue
+		}
+		doc, path := s.layer.doc, s.layer.prefix+field.key
+		target := v.Field(field.index)
+		dec := json.NewDecoder(bytes.NewReader(s.raw))
+		dec.DisallowUnknownFields() // inside lists of objects such as mounts
+		dec.UseNumber()             // keep numbers in free-form objects exact
+		if err := dec.Decode(target.Addr().Interface()); err != nil {
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) {
+				return doc.errorf(path, "invalid value for %s: expected %s, got %s", field.key, typeErr.Type, typeErr.Value)
+			}
+			if name, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+				return doc.errorf(path, "unknown key %s in %s", name, field.key)
+			}
+			return doc.errorf(path, "invalid value for %s: %v", field.key, err)
+		}
+		if err := expandEnvField(target); err != nil {
+			return doc.errorf(path, "%s: %v", field.key, err)
+		}
+		sources[field.key] = s.layer.source
+	}
+	return nil
+}
+
+// loadConfigFiles reads the config files in order and applies them, with the
+// given profile's overlays, to config. An empty profile selects no overlay;
+// a profile that no file defines is an error.
+func loadConfigFiles(paths []string, profile string, config *Config, sources ConfigSources) error {
+	var layers []configLayer
+	profileFound := false
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		doc, err := parseConfigFile(path, data)
+		if err != nil {
+			return err
+		}
+		docLayers, err := doc.layers(profile)
+		if err != nil {
+			return err
+		}
+		profileFound = profileFound || len(docLayers) > 1
+		layers = append(layers, docLayers...)
+	}
+	if profile != "" && !profileFound {
+		return fmt.Errorf("profile %q is not defined in any config file", profile)
+	}
+	return applyConfigLayers(layers, config, sources)
+}
+
+// expandEnvField expands environment variables in a string field, and in the
+// strings inside list and object fields.
+func expandEnvField(field reflect.Value) error {
+	switch field.Kind() {
+	case reflect.String:
+		expanded, err := expandEnv(field.String())
+		if err != nil {
+			return err
+		}
+		field.SetString(expanded)
+	case reflect.Slice:
+		for i := 0; i < field.Len(); i++ {
+			if err := expandEnvField(field.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < field.NumField(); i++ {
+			if err := expandEnvField(field.Field(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, key := range field.MapKeys() {
+			value, err := expandEnvValue(field.MapIndex(key).Interface())
+			if err != nil {
+				return err
+			}
+			if value != nil {
+				field.SetMapIndex(key, reflect.ValueOf(value))
+			}
+		}
+	}
+	return nil
+}
+
+// expandEnvValue expands environment variables in the strings of a decoded
+// free-form JSON value.
+func expandEnvValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return expandEnv(v)
+	case []interface{}:
+		for i := range v {
+			expanded, err := expandEnvValue(v[i])
+			if err != nil {
+				return nil, err
+			}
+			v[i] = expanded
+		}
+	case map[string]interface{}:
+		for key := range v {
+			expanded, err := expandEnvValue(v[key])
+			if err != nil {
+				return nil, err
+			}
+			v[key] = expanded
+		}
+	}
+	return value, nil
+}
+
+// expandEnv replaces ${VAR} in s with the value of the environment variable
+// VAR, failing if it is not set. $$ stands for a literal $, and a $ that is not
+// followed by { or $ is left alone.
+func expandEnv(s string) (string, error) {
+	if !strings.Contains(s, "$") {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		switch s[i+1] {
+		case '$':
+			b.WriteByte('$')
+			i++
+		case '{':
+			end := strings.IndexByte(s[i+2:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated ${ in %q", s)
+			}
+			name := s[i+2 : i+2+end]
+			if name == "" {
+				return "", fmt.Errorf("empty variable name in %q", s)
+			}
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				return "", fmt.Errorf("environment variable %s is not set", name)
+			}
+			b.WriteString(value)
+			i += 2 + end
+		default:
+			b.WriteByte('$')
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,313 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// loadConfigFile loads a config from a file with the given name and content,
+// as if it had been passed with --config.
+func loadConfigFile(t *testing.T, name, content string) (*Config, ConfigSources, error) {
+	path := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return (&ConfigFlags{configFiles: []string{path}}).Load()
+}
+
+func TestConfigFile_Formats(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"config.json", `{
+  "static_dir": "./dist",
+  "port": 9000,
+  "acme_domains": ["a.example.com", "b.example.com"],
+  "strict_startup": true,
+  "csp_header": "default-src 'self'"
+}`},
+		{"config.yaml", `# Serve the production build
+static_dir: ./dist
+port: 9000
+acme_domains:
+  - a.example.com
+  - b.example.com
+strict_startup: true
+# Only allow resources from our own origin
+csp_header: "default-src 'self'"
+`},
+		{"config.yml", `{static_dir: ./dist, port: 9000, acme_domains: [a.example.com, b.example.com], strict_startup: true, csp_header: "default-src 'self'"}`},
+		{"config.toml", `# Serve the production build
+static_dir = "./dist"
+port = 9000
+acme_domains = ["a.example.com", "b.example.com"]
+strict_startup = true
+csp_header = "default-src 'self'" # only our own origin
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, sources, err := loadConfigFile(t, tt.name, tt.content)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, "./dist", config.StaticDir)
+			assert.Equal(t, 9000, config.Port)
+			assert.Equal(t, []string{"a.example.com", "b.example.com"}, config.ACMEDomains)
+			assert.True(t, config.StrictStartup)
+			assert.Equal(t, "default-src 'self'", config.CSPHeader)
+			assert.Equal(t, "index.html", config.SpaFallbackFile)
+			assert.Contains(t, sources["port"], "file ")
+			assert.Equal(t, "default", sources["spa_fallback_file"])
+		})
+	}
+}
+
+func TestConfigFile_UnknownKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		wantErrs []string
+	}{
+		{"config.json", "{\n  \"port\": 9000,\n  \"hsts_maxage\": 60\n}", []string{`config.json:3:3: unknown config key "hsts_maxage"`}},
+		{"config.json", `{"nested": {"port": 1}, "port": 9000, "typo": [1, {"a": 2}]}`, []string{`config.json:1:2: unknown config key "nested"`, `config.json:1:39: unknown config key "typo"`}},
+		{"config.yaml", "port: 9000\n\n  # comment\nhsts_maxage: 60\n", []string{`config.yaml:4:1: unknown config key "hsts_maxage"`}},
+		{"config.toml", "port = 9000\n  hsts_maxage = 60\n", []string{`config.toml:2:3: unknown config key "hsts_maxage"`}},
+		{"config.toml", "port = 9000\n\n[tls]\ncert_file = \"tls.crt\"\n", []string{`config.toml:3:2: unknown config key "tls"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, _, err := loadConfigFile(t, tt.name, tt.content)
+			assert.Nil(t, config)
+			if assert.Error(t, err) {
+				for _, want := range tt.wantErrs {
+					assert.Contains(t, err.Error(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigFile_InvalidValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"config.json", "{\n  \"port\": \"http\"\n}", `config.json:2:3: invalid value for port: expected int, got string`},
+		{"config.yaml", "h2c: yes please\n", `config.yaml:1:1: invalid value for h2c: expected bool, got string`},
+		{"config.toml", "acme_domains = \"a.example.com\"\n", `config.toml:1:1: invalid value for acme_domains: expected []string, got string`},
+		{"config.json", "{\n  \"port\": 9000,\n}", `config.json:3:1: invalid character '}'`},
+		{"config.toml", "port = \n", `config.toml:1:8:`},
+		{"config.yaml", "- port\n", `config.yaml:1:1: expected a mapping of config keys`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, _, err := loadConfigFile(t, tt.name, tt.content)
+			assert.Nil(t, config)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigFile_DefaultFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	originalDir, _ := os.Getwd()
+	defer os.Chdir(originalDir)
+	assert.NoError(t, os.Chdir(tempDir))
+
+	assert.NoError(t, os.WriteFile(".go-spa-server-config.yaml", []byte("port: 9000\n"), 0644))
+	config, err := LoadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, 9000, config.Port)
+
+	assert.NoError(t, os.WriteFile(".go-spa-server-config.toml", []byte("port = 9001\n"), 0644))
+	config, err = LoadConfig()
+	assert.Error(t, err)
+	assert.Nil(t, config)
+}
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("CDN_HOST", "cdn.example.com")
+	t.Setenv("EMPTY", "")
+
+	tests := []struct {
+		in      string
+		want    string
+		wantErr string
+	}{
+		{"no variables", "no variables", ""},
+		{"img-src https://${CDN_HOST}", "img-src https://cdn.example.com", ""},
+		{"${CDN_HOST}/${CDN_HOST}", "cdn.example.com/cdn.example.com", ""},
+		{"[${EMPTY}]", "[]", ""},
+		{"$$${CDN_HOST} costs $5$", "$cdn.example.com costs $5$", ""},
+		{"$${CDN_HOST}", "${CDN_HOST}", ""},
+		{"${MISSING_VARIABLE}", "", "environment variable MISSING_VARIABLE is not set"},
+		{"${CDN_HOST", "", `unterminated ${ in "${CDN_HOST"`},
+		{"${}", "", `empty variable name in "${}"`},
+	}
+	for _, tt := range tests {
+		got, err := expandEnv(tt.in)
+		if tt.wantErr != "" {
+			assert.EqualError(t, err, tt.wantErr, tt.in)
+			continue
+		}
+		assert.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, got, tt.in)
+	}
+}
+
+func TestConfigFile_ExpandsEnv(t *testing.T) {
+	t.Setenv("CDN_HOST", "cdn.example.com")
+	t.Setenv("DOMAIN", "example.com")
+
+	config, _, err := loadConfigFile(t, "config.yaml", `csp_header: "default-src 'self'; img-src https://${CDN_HOST}"
+acme_domains: ["${DOMAIN}", "www.${DOMAIN}"]
+port: 9000
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, "default-src 'self'; img-src https://cdn.example.com", config.CSPHeader)
+	assert.Equal(t, []string{"example.com", "www.example.com"}, config.ACMEDomains)
+
+	_, _, err = loadConfigFile(t, "config.toml", "port = 9000\ncsp_header = \"img-src ${MISSING_CDN_HOST}\"\n")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "config.toml:2:1: csp_header: environment variable MISSING_CDN_HOST is not set")
+	}
+}
+
+func TestConfigFile_Profiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"config.yaml", `csp_header: "default-src 'self'"
+hsts_max_age: 60
+profiles:
+  prod:
+    hsts_max_age: 31536000
+  dev:
+    csp_header: "default-src *"
+`},
+		{"config.toml", `csp_header = "default-src 'self'"
+hsts_max_age = 60
+
+[profiles.prod]
+hsts_max_age = 31536000
+
+[profiles.dev]
+csp_header = "default-src *"
+`},
+		{"config.json", `{
+  "csp_header": "default-src 'self'",
+  "hsts_max_age": 60,
+  "profiles": {
+    "prod": {"hsts_max_age": 31536000},
+    "dev": {"csp_header": "default-src *"}
+  }
+}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.name)
+			assert.NoError(t, os.WriteFile(path, []byte(tt.content), 0644))
+
+			config, sources, err := (&ConfigFlags{configFiles: []string{path}}).Load()
+			assert.NoError(t, err)
+			assert.Equal(t, 60, config.HSTSMaxAge)
+			assert.Equal(t, "default-src 'self'", config.CSPHeader)
+
+			t.Setenv("SPA_PROFILE", "prod")
+			config, sources, err = (&ConfigFlags{configFiles: []string{path}}).Load()
+			assert.NoError(t, err)
+			assert.Equal(t, 31536000, config.HSTSMaxAge)
+			assert.Equal(t, "default-src 'self'", config.CSPHeader)
+			assert.Equal(t, "file "+path+" (profile prod)", sources["hsts_max_age"])
+			assert.Equal(t, "file "+path, sources["csp_header"])
+
+			// --profile takes precedence over SPA_PROFILE.
+			config, _, err = (&ConfigFlags{configFiles: []string{path}, profile: "dev"}).Load()
+			assert.NoError(t, err)
+			assert.Equal(t, 60, config.HSTSMaxAge)
+			assert.Equal(t, "default-src *", config.CSPHeader)
+
+			_, _, err = (&ConfigFlags{configFiles: []string{path}, profile: "staging"}).Load()
+			assert.EqualError(t, err, `profile "staging" is not defined in any config file`)
+		})
+	}
+}
+
+func TestConfigFile_ProfileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"config.yaml", "profiles:\n  prod:\n    hsts_maxage: 60\n", `config.yaml:3:5: unknown config key "profiles.prod.hsts_maxage"`},
+		{"config.toml", "[profiles.prod]\nport = 1\nhsts_maxage = 60\n", `config.toml:3:1: unknown config key "profiles.prod.hsts_maxage"`},
+		{"config.json", "{\"profiles\": {\n  \"prod\": {\"hsts_maxage\": 60}}}", `config.json:2:12: unknown config key "profiles.prod.hsts_maxage"`},
+		{"config.yaml", "profiles:\n  prod:\n    port: http\n", `config.yaml:3:5: invalid value for port: expected int, got string`},
+		{"config.yaml", "port: 9000\nprofiles: [prod]\n", `config.yaml:2:1: profiles must map profile names to settings`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SPA_PROFILE", "prod")
+			_, _, err := loadConfigFile(t, tt.name, tt.content)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigFile_MultipleFiles(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.yaml")
+	assert.NoError(t, os.WriteFile(base, []byte(`static_dir: ./dist
+csp_header: "default-src 'self'"
+hsts_max_age: 60
+profiles:
+  prod:
+    hsts_max_age: 31536000
+    referrer_policy: no-referrer
+`), 0644))
+	prod := filepath.Join(dir, "prod.toml")
+	assert.NoError(t, os.WriteFile(prod, []byte(`csp_header = "default-src 'none'"
+hsts_max_age = 120
+`), 0644))
+
+	flags := &ConfigFlags{configFiles: []string{base, prod}, profile: "prod"}
+	config, sources, err := flags.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "./dist", config.StaticDir)
+	assert.Equal(t, "default-src 'none'", config.CSPHeader)
+	assert.Equal(t, 120, config.HSTSMaxAge) // later files win over earlier profiles
+	assert.Equal(t, "no-referrer", config.ReferrerPolicy)
+	assert.Equal(t, "file "+base, sources["static_dir"])
+	assert.Equal(t, "file "+prod, sources["hsts_max_age"])
+	assert.Equal(t, "file "+base+" (profile prod)", sources["referrer_policy"])
+
+	// Every file given with --config must exist.
+	flags = &ConfigFlags{configFiles: []string{base, filepath.Join(dir, "missing.yaml")}}
+	_, _, err = flags.Load()
+	assert.Error(t, err)
+}
+
+func TestMergeJSON(t *testing.T) {
+	tests := []struct {
+		base, overlay, want string
+	}{
+		{`1`, `2`, `2`},
+		{`["a", "b"]`, `["c"]`, `["c"]`},
+		{`{"a": 1, "b": {"c": 1, "d": 1}}`, `{"b": {"d": 2, "e": 2}, "f": 2}`, `{"a":1,"b":{"c":1,"d":2,"e":2},"f":2}`},
+		{`{"a": {"b": 1}}`, `{"a": null}`, `{"a":null}`},
+		{`{"a": 1}`, `"replaced"`, `"replaced"`},
+	}
+	for _, tt := range tests {
+		got := mergeJSON([]byte(tt.base), []byte(tt.overlay))
+		assert.JSONEq(t, tt.want, string(got), "merging %s into %s", tt.overlay, tt.base)
+	}
+}
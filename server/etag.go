@@ -0,0 +1,100 @@
+package server
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// contentETag returns a strong ETag for content, derived from a hash of its
+// bytes so that it only changes when they do: a redeploy that rewrites
+// unchanged files keeps their ETags.
+func contentETag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return fmt.Sprintf("\"%x\"", sum[:16])
+}
+
+// fileETagEntry is the ETag of a file, valid while its modification time and
+// size are unchanged.
+type fileETagEntry struct {
+	modTime time.Time
+	size    int64
+	etag    string
+}
+
+var (
+	// fileETagsMu guards fileETags, the ETags of files served from disk by path.
+	fileETagsMu sync.Mutex
+	fileETags   = make(map[string]fileETagEntry)
+)
+
+// fileETag returns the content ETag of the file at filePath, whose current
+// info is given. The file is only hashed again once its modification time or
+// size changes.
+func fileETag(filePath string, info os.FileInfo) (string, error) {
+	fileETagsMu.Lock()
+	entry, ok := fileETags[filePath]
+	fileETagsMu.Unlock()
+	if ok && entry.modTime.Equal(info.ModTime()) && entry.size == info.Size() {
+		return entry.etag, nil
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	etag := fmt.Sprintf("\"%x\"", hash.Sum(nil)[:16])
+
+	fileETagsMu.Lock()
+	fileETags[filePath] = fileETagEntry{modTime: info.ModTime(), size: info.Size(), etag: etag}
+	fileETagsMu.Unlock()
+	return etag, nil
+}
+
+// runtimeCodings are the content codings the runtime compressors apply.
+var runtimeCodings = []string{"br", "gzip"}
+
+// encodedETag returns etag with coding appended, e.g. "<hash>-br", for a
+// response the runtime compressors encode, so that each coding of a file has a
+// strong ETag of its own (RFC 9110, section 8.8.3). An ETag that already names
+// a coding is returned as is.
+func encodedETag(etag, coding string) string {
+	if !strings.HasSuffix(etag, `"`) {
+		return etag
+	}
+	for _, c := range runtimeCodings {
+		if strings.HasSuffix(etag, "-"+c+`"`) {
+			return etag
+		}
+	}
+	return strings.TrimSuffix(etag, `"`) + "-" + coding + `"`
+}
+
+// decodedETag returns etag without the coding encodedETag appended.
+func decodedETag(etag, coding string) string {
+	if trimmed, ok := strings.CutSuffix(etag, "-"+coding+`"`); ok {
+		return trimmed + `"`
+	}
+	return etag
+}
+
+// stripEncodedETags removes coding from the entity tags in the If-None-Match
+// and If-Match headers of r, so that the handler, which only knows the ETag of
+// the unencoded file, matches the ETag a compressed response was sent with.
+func stripEncodedETags(r *http.Request, coding string) {
+	for _, name := range []string{"If-None-Match", "If-Match"} {
+		if value := r.Header.Get(name); value != "" {
+			r.Header.Set(name, strings.ReplaceAll(value, "-"+coding+`"`, `"`))
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileETag(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.js")
+	b := filepath.Join(dir, "b.js")
+	assert.NoError(t, os.WriteFile(a, []byte("same"), 0644))
+	assert.NoError(t, os.WriteFile(b, []byte("same"), 0644))
+
+	etag := func(name string) string {
+		info, err := os.Stat(name)
+		assert.NoError(t, err)
+		etag, err := fileETag(name, info)
+		assert.NoError(t, err)
+		return etag
+	}
+
+	first := etag(a)
+	assert.Equal(t, contentETag([]byte("same")), first)
+	assert.Equal(t, first, etag(b), "files with the same content share an ETag")
+
+	// Rewriting the file with the same content, as a redeploy does, keeps it
+	later := time.Now().Add(time.Hour)
+	assert.NoError(t, os.Chtimes(a, later, later))
+	assert.Equal(t, first, etag(a))
+
+	// New content gets a new ETag
+	assert.NoError(t, os.WriteFile(a, []byte("changed"), 0644))
+	assert.NoError(t, os.Chtimes(a, later.Add(time.Hour), later.Add(time.Hour)))
+	assert.NotEqual(t, first, etag(a))
+}
+
+func TestSpaHandler_ConditionalRequests(t *testing.T) {
+	t.Cleanup(func() {
+		for k := range inMemoryCache {
+			delete(inMemoryCache, k)
+		}
+	})
+	staticDir := appDir(t, "main")
+	assert.NoError(t, os.WriteFile(filepath.Join(staticDir, "vite.svg"), []byte("<svg></svg>"), 0644))
+	assert.NoError(t, LoadCriticalAssetsIntoCache(staticDir))
+	handler := CreateSpaHandler(&Config{StaticDir: staticDir, SpaFallbackFile: "index.html"})
+
+	past := time.Now().Add(-24 * time.Hour).Format(http.TimeFormat)
+	future := time.Now().Add(24 * time.Hour).Format(http.TimeFormat)
+
+	// vite.svg is served from the cache, app.js from disk
+	for _, path := range []string{"/vite.svg", "/app.js"} {
+		rr := httptestGet(handler, path)
+		etag := rr.Header().Get("ETag")
+		assert.Regexp(t, `^"[0-9a-f]{32}"$`, etag, path)
+
+		tests := []struct {
+			name       string
+			headers    map[string]string
+			wantStatus int
+		}{
+			{"if-none-match", map[string]string{"If-None-Match": etag}, http.StatusNotModified},
+			{"if-none-match list", map[string]string{"If-None-Match": `"other", ` + etag}, http.StatusNotModified},
+			{"if-none-match weak", map[string]string{"If-None-Match": "W/" + etag}, http.StatusNotModified},
+			{"if-none-match any", map[string]string{"If-None-Match": "*"}, http.StatusNotModified},
+			{"if-none-match overrides if-modified-since", map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": future}, http.StatusOK},
+			{"if-modified-since", map[string]string{"If-Modified-Since": future}, http.StatusNotModified},
+			{"modified since", map[string]string{"If-Modified-Since": past}, http.StatusOK},
+			{"if-match", map[string]string{"If-Match": etag}, http.StatusOK},
+			{"if-match mismatch", map[string]string{"If-Match": `"other"`}, http.StatusPreconditionFailed},
+			{"if-match weak", map[string]string{"If-Match": "W/" + etag}, http.StatusPreconditionFailed},
+			{"if-match overrides if-unmodified-since", map[string]string{"If-Match": etag, "If-Unmodified-Since": past}, http.StatusOK},
+			{"if-unmodified-since", map[string]string{"If-Unmodified-Since": past}, http.StatusPreconditionFailed},
+			{"unmodified since", map[string]string{"If-Unmodified-Since": future}, http.StatusOK},
+			{"if-range", map[string]string{"Range": "bytes=0-1", "If-Range": etag}, http.StatusPartialContent},
+			{"if-range mismatch", map[string]string{"Range": "bytes=0-1", "If-Range": `"other"`}, http.StatusOK},
+		}
+		for _, tt := range tests {
+			t.Run(path+" "+tt.name, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				for name, value := range tt.headers {
+					req.Header.Set(name, value)
+				}
+				rr := httptest.NewRecorder()
+				handler.ServeHTTP(rr, req)
+				assert.Equal(t, tt.wantStatus, rr.Code)
+				if tt.wantStatus == http.StatusNotModified {
+					assert.Equal(t, etag, rr.Header().Get("ETag"))
+					assert.Zero(t, rr.Body.Len())
+				}
+			})
+		}
+	}
+}
@@ -1,22 +1,40 @@
 package server
 
 import (
-	"fmt"
+	"bytes"
+	"mime"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
-	"time"
+	"strings"
 )
 
-// HealthzHandler returns a 200 OK for health checks.
+// HealthzHandler returns a 200 OK for health checks, or 503 Service Unavailable
+// once the server has started shutting down.
 func HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	if draining.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 }
 
 // CreateSpaHandler creates an http.Handler that serves static files
 // and falls back to index.html for client-side routes.
 func CreateSpaHandler(config *Config) http.Handler {
-	fs := http.FileServer(http.Dir(config.StaticDir))
+	return newSpaHandler(config, "", GetCachedAsset)
+}
+
+// newSpaHandler is CreateSpaHandler for an app mounted at cachePrefix, whose
+// requests arrive with the prefix stripped. Its cached assets are looked up in
+// assets under the prefix.
+func newSpaHandler(config *Config, cachePrefix string, assets assetLookup) http.Handler {
+	// The fallback HTML as rendered, nil if it is served as is
+	var fallback *renderedFallback
+	if render := fallbackRenderer(config, cachePrefix); render != nil {
+		fallback = &renderedFallback{render: render}
+	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Try to serve from in-memory cache first
@@ -24,84 +42,191 @@ func CreateSpaHandler(config *Config) http.Handler {
 		if cachePath == "/" {
 			cachePath = "/" + config.SpaFallbackFile
 		}
-		if cachedAsset, ok := GetCachedAsset(cachePath); ok { // Use GetCachedAsset from cache package
-			// Set Content-Type
+		if cachedAsset, ok := assets(cachePrefix + cachePath); ok {
+			// Set Content-Type and Cache-Control
 			w.Header().Set("Content-Type", cachedAsset.MimeType)
+			setCacheControl(w.Header(), config, cachePath)
 
-			// Generate ETag for cached content
-			etag := fmt.Sprintf("\"%x-%x\"", cachedAsset.ModTime.Unix(), cachedAsset.Size)
-			w.Header().Set("ETag", etag)
-
-			// Set Last-Modified header for cached content
-			w.Header().Set("Last-Modified", cachedAsset.ModTime.Format(http.TimeFormat))
-
-			// Check If-None-Match for cached content
-			ifNoneMatch := r.Header.Get("If-None-Match")
-			if ifNoneMatch != "" && ifNoneMatch == etag {
-				w.WriteHeader(http.StatusNotModified)
+			// Prefer a precompressed sibling, as for the same file on disk
+			isFallback := cachePath == "/"+config.SpaFallbackFile
+			if !isFallback && servePrecompressed(w, r, filepath.Join(config.StaticDir, filepath.FromSlash(cachePath))) {
 				return
 			}
 
-			// Check If-Modified-Since for cached content
-			ifModifiedSince := r.Header.Get("If-Modified-Since")
-			if ifModifiedSince != "" {
-				t, err := http.ParseTime(ifModifiedSince)
-				if err == nil && cachedAsset.ModTime.Before(t.Add(1*time.Second)) {
-					w.WriteHeader(http.StatusNotModified)
-					return
-				}
+			// The ETag covers what was injected into the fallback HTML
+			content, etag := cachedAsset.Content, cachedAsset.ETag
+			if fallback != nil && isFallback {
+				content, etag, _ = fallback.get(cachedAsset.ModTime, cachedAsset.Size, func() ([]byte, error) {
+					return cachedAsset.Content, nil
+				})
 			}
+			w.Header().Set("ETag", etag)
 
-			w.Write(cachedAsset.Content)
+			// ServeContent sets Last-Modified and evaluates the conditional headers
+			http.ServeContent(w, r, cachePath, cachedAsset.ModTime, bytes.NewReader(content))
 			return
 		}
 
-		// Original logic for serving from disk if not in cache
-		requestedPath := filepath.Join(config.StaticDir, r.URL.Path)
-		serveFilePath := requestedPath // Assume requested path initially
-
-		// Check if the requested file exists, otherwise fallback to index.html
-		_, err := os.Stat(requestedPath)
-		if r.URL.Path == "/" || os.IsNotExist(err) {
+		// Original logic for serving from disk if not in cache. Resolve the
+		// request to a file, otherwise fallback to index.html for client-side
+		// routes and 404 for anything else
+		serveFilePath := ""
+		if r.URL.Path != "/" {
+			filePath, redirect := resolveFile(config, r.URL.Path)
+			if redirect != "" {
+				localRedirect(w, r, redirect)
+				return
+			}
+			if filePath == "" && !shouldFallback(config, r) {
+				serveNotFound(w, r, config)
+				return
+			}
+			serveFilePath = filePath
+		}
+		isFallback := serveFilePath == ""
+		if isFallback {
 			serveFilePath = filepath.Join(config.StaticDir, config.SpaFallbackFile)
 		}
 
+		// Cache the file the request resolved to the same way however it is
+		// addressed, e.g. /pricing and /pricing.html, and the fallback HTML as
+		// the fallback file whatever the path
+		if rel, err := filepath.Rel(config.StaticDir, serveFilePath); err == nil {
+			setCacheControl(w.Header(), config, "/"+filepath.ToSlash(rel))
+		}
+
 		// Get file info for ETag and Last-Modified
 		fileInfo, err := os.Stat(serveFilePath)
 		if err != nil {
-			http.NotFound(w, r)
+			serveNotFound(w, r, config)
 			return
 		}
 
-		// Generate ETag
-		etag := fmt.Sprintf("\"%x-%x\"", fileInfo.ModTime().Unix(), fileInfo.Size())
-		w.Header().Set("ETag", etag)
-
-		// Set Last-Modified header
-		w.Header().Set("Last-Modified", fileInfo.ModTime().Format(http.TimeFormat))
-
-		// Check If-None-Match
-		ifNoneMatch := r.Header.Get("If-None-Match")
-		if ifNoneMatch != "" && ifNoneMatch == etag {
-			w.WriteHeader(http.StatusNotModified)
+		// Prefer a precompressed sibling of a static file, e.g. app.js.br
+		if !isFallback && servePrecompressed(w, r, serveFilePath) {
 			return
 		}
 
-		// Check If-Modified-Since
-		ifModifiedSince := r.Header.Get("If-Modified-Since")
-		if ifModifiedSince != "" {
-			t, err := http.ParseTime(ifModifiedSince)
-			if err == nil && fileInfo.ModTime().Before(t.Add(1*time.Second)) { // Add 1 second tolerance
-				w.WriteHeader(http.StatusNotModified)
+		// Rendered fallback HTML gets the ETag of what it was rendered to
+		if fallback != nil && isFallback {
+			rendered, etag, err := fallback.get(fileInfo.ModTime(), fileInfo.Size(), func() ([]byte, error) {
+				return os.ReadFile(serveFilePath)
+			})
+			if err != nil {
+				serveNotFound(w, r, config)
 				return
 			}
+			w.Header().Set("ETag", etag)
+			http.ServeContent(w, r, serveFilePath, fileInfo.ModTime(), bytes.NewReader(rendered))
+			return
 		}
 
-		// If not 304, serve the file
-		if serveFilePath == requestedPath {
-			fs.ServeHTTP(w, r) // Serve the requested file
-		} else {
-			http.ServeFile(w, r, serveFilePath) // Serve index.html fallback
+		// Files get the ETag of their content, which ServeContent uses along
+		// with Last-Modified to evaluate the conditional headers. Unlike
+		// ServeFile, it serves the file as resolved, without redirecting
+		// /index.html, the same as a cached copy is served.
+		if !fileInfo.Mode().IsRegular() {
+			serveNotFound(w, r, config)
+			return
 		}
+		file, err := os.Open(serveFilePath)
+		if err != nil {
+			serveNotFound(w, r, config)
+			return
+		}
+		defer file.Close()
+		if etag, err := fileETag(serveFilePath, fileInfo); err == nil {
+			w.Header().Set("ETag", etag)
+		}
+		http.ServeContent(w, r, serveFilePath, fileInfo.ModTime(), file)
 	})
 }
+
+// resolveFile maps a request path to the file in the static directory that
+// serves it, or returns the relative path to redirect to instead. It returns
+// neither if no file matches, for the SPA fallback to apply. A directory is
+// served by its index.html, at a path ending in a slash, and never listed.
+// With CleanURLs, a path is also served by the .html file of the same name, at
+// a path without the slash.
+func resolveFile(config *Config, urlPath string) (filePath, redirect string) {
+	name := filepath.Join(config.StaticDir, filepath.FromSlash(path.Clean("/"+urlPath)))
+	trailingSlash := strings.HasSuffix(urlPath, "/")
+
+	if info, err := os.Stat(name); err == nil {
+		index := filepath.Join(name, "index.html")
+		switch {
+		case info.Mode().IsRegular() && !trailingSlash:
+			return name, ""
+		case info.IsDir() && isRegularFile(index):
+			if !trailingSlash {
+				return "", path.Base(urlPath) + "/"
+			}
+			return index, ""
+		}
+	}
+	if config.CleanURLs && isRegularFile(name+".html") {
+		if trailingSlash {
+			return "", "../" + path.Base(urlPath)
+		}
+		return name + ".html", ""
+	}
+	return "", ""
+}
+
+// isRegularFile reports whether name is a regular file.
+func isRegularFile(name string) bool {
+	info, err := os.Stat(name)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// localRedirect permanently redirects to target, a path relative to the
+// request's. Unlike http.Redirect it leaves target relative, so it stays
+// correct when a base path or mount prefix was stripped from the request.
+func localRedirect(w http.ResponseWriter, r *http.Request, target string) {
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	w.Header().Set("Location", target)
+	w.WriteHeader(http.StatusMovedPermanently)
+}
+
+// shouldFallback reports whether a request for a missing file gets the SPA
+// fallback file. Unless FallbackMode is FallbackAlways, only requests that look
+// like page navigations do: those for paths without a file extension, or that
+// accept HTML. A missing script or stylesheet gets a 404 instead of HTML the
+// browser would try to run. Paths under FallbackExclude never fall back.
+func shouldFallback(config *Config, r *http.Request) bool {
+	for _, prefix := range config.FallbackExclude {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return false
+		}
+	}
+	if config.FallbackMode == FallbackAlways {
+		return true
+	}
+	return path.Ext(r.URL.Path) == "" || strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// serveNotFound replies with 404 Not Found, using the configured NotFoundFile
+// as the body if it can be read.
+func serveNotFound(w http.ResponseWriter, r *http.Request, config *Config) {
+	// Replace the Cache-Control chosen from the path, such as immutable for
+	// /assets/, so that a file missing during a deploy is not cached as missing
+	w.Header().Set("Cache-Control", "no-cache")
+	if config.NotFoundFile == "" {
+		http.NotFound(w, r)
+		return
+	}
+	content, err := os.ReadFile(filepath.Join(config.StaticDir, config.NotFoundFile))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(config.NotFoundFile))
+	if contentType == "" {
+		contentType = "text/html; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusNotFound)
+	w.Write(content)
+}
@@ -208,3 +208,175 @@ func TestCreateSpaHandler_NotModifiedHeaders(t *testing.T) {
 		assert.Equal(t, http.StatusNotModified, rr.Code) // Should return 304 if not modified since
 	})
 }
+
+func TestSpaHandler_FallbackRules(t *testing.T) {
+	staticDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(staticDir, "index.html"), []byte("<html>app</html>"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(staticDir, "404.html"), []byte("<html>not found</html>"), 0644))
+
+	tests := []struct {
+		name     string
+		config   Config
+		path     string
+		accept   string
+		wantCode int
+		wantBody string
+	}{
+		{"client route", Config{}, "/users/1", "", http.StatusOK, "<html>app</html>"},
+		{"dotted route navigation", Config{}, "/users/jane.doe", "text/html,application/xhtml+xml", http.StatusOK, "<html>app</html>"},
+		{"missing script", Config{}, "/assets/index-old.js", "*/*", http.StatusNotFound, "404 page not found\n"},
+		{"missing script with not found file", Config{NotFoundFile: "404.html"}, "/assets/index-old.js", "*/*", http.StatusNotFound, "<html>not found</html>"},
+		{"always mode", Config{FallbackMode: FallbackAlways}, "/assets/index-old.js", "*/*", http.StatusOK, "<html>app</html>"},
+		{"excluded prefix", Config{FallbackExclude: []string{"/api/"}, NotFoundFile: "404.html"}, "/api/users", "text/html", http.StatusNotFound, "<html>not found</html>"},
+		{"excluded prefix in always mode", Config{FallbackMode: FallbackAlways, FallbackExclude: []string{"/api/"}}, "/api/users", "", http.StatusNotFound, "404 page not found\n"},
+		{"missing not found file", Config{NotFoundFile: "missing.html"}, "/x.css", "", http.StatusNotFound, "404 page not found\n"},
+		{"existing file", Config{FallbackExclude: []string{"/"}}, "/404.html", "", http.StatusOK, "<html>not found</html>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			config.StaticDir = staticDir
+			config.SpaFallbackFile = "index.html"
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rr := httptest.NewRecorder()
+			CreateSpaHandler(&config).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantCode, rr.Code)
+			assert.Equal(t, tt.wantBody, rr.Body.String())
+		})
+	}
+}
+
+func TestNewHandler_NotFoundIsNotCached(t *testing.T) {
+	staticDir := appDir(t, "main")
+	assert.NoError(t, os.WriteFile(filepath.Join(staticDir, "404.html"), []byte("<html>not found</html>"), 0644))
+
+	for _, notFoundFile := range []string{"", "404.html"} {
+		config := defaultConfig()
+		config.StaticDir = staticDir
+		config.NotFoundFile = notFoundFile
+		handler := NewHandler(config)
+
+		// Missing assets would otherwise get the long-lived caching of their path
+		for _, path := range []string{"/assets/index-old.js", "/missing.css"} {
+			rr := httptestGet(handler, path)
+			assert.Equal(t, http.StatusNotFound, rr.Code, path)
+			assert.Equal(t, "no-cache", rr.Header().Get("Cache-Control"), "%s with not_found_file %q", path, notFoundFile)
+		}
+	}
+}
+
+func TestSpaHandler_CleanURLs(t *testing.T) {
+	staticDir := t.TempDir()
+	files := map[string]string{
+		"index.html":        "<html>app</html>",
+		"pricing.html":      "<html>pricing</html>",
+		"docs/index.html":   "<html>docs</html>",
+		"docs/intro.html":   "<html>intro</html>",
+		"assets/app.js":     "// app",
+		"about/index.html":  "<html>about dir</html>",
+		"about.html":        "<html>about page</html>",
+		"downloads/app.zip": "zip",
+	}
+	for name, content := range files {
+		assert.NoError(t, os.MkdirAll(filepath.Join(staticDir, filepath.Dir(name)), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(staticDir, name), []byte(content), 0644))
+	}
+
+	tests := []struct {
+		name         string
+		cleanURLs    bool
+		path         string
+		wantCode     int
+		wantBody     string
+		wantLocation string
+	}{
+		{"directory index", false, "/docs/", http.StatusOK, "<html>docs</html>", ""},
+		{"directory without slash", false, "/docs", http.StatusMovedPermanently, "", "docs/"},
+		{"directory redirect keeps query", false, "/docs?page=2", http.StatusMovedPermanently, "", "docs/?page=2"},
+		{"directory without index falls back", false, "/downloads/", http.StatusOK, "<html>app</html>", ""},
+		{"assets directory is not listed", false, "/assets/", http.StatusOK, "<html>app</html>", ""},
+		{"page without clean urls falls back", false, "/pricing", http.StatusOK, "<html>app</html>", ""},
+		{"page with extension", false, "/pricing.html", http.StatusOK, "<html>pricing</html>", ""},
+		{"clean url", true, "/pricing", http.StatusOK, "<html>pricing</html>", ""},
+		{"nested clean url", true, "/docs/intro", http.StatusOK, "<html>intro</html>", ""},
+		{"clean url with slash", true, "/pricing/", http.StatusMovedPermanently, "", "../pricing"},
+		{"directory wins over page", true, "/about/", http.StatusOK, "<html>about dir</html>", ""},
+		{"directory wins without slash", true, "/about", http.StatusMovedPermanently, "", "about/"},
+		{"missing page falls back", true, "/users/1", http.StatusOK, "<html>app</html>", ""},
+		{"existing file", true, "/assets/app.js", http.StatusOK, "// app", ""},
+		{"file with slash is a navigation", true, "/assets/app.js/", http.StatusOK, "<html>app</html>", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{StaticDir: staticDir, SpaFallbackFile: "index.html", CleanURLs: tt.cleanURLs}
+			rr := httptestGet(CreateSpaHandler(config), tt.path)
+
+			assert.Equal(t, tt.wantCode, rr.Code)
+			assert.Equal(t, tt.wantLocation, rr.Header().Get("Location"))
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestNewHandler_CacheControlOfResolvedFile(t *testing.T) {
+	staticDir := appDir(t, "main")
+	assert.NoError(t, os.MkdirAll(filepath.Join(staticDir, "docs"), 0755))
+	assert.NoError(t, os.MkdirAll(filepath.Join(staticDir, "assets"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(staticDir, "docs", "index.html"), []byte("<html>docs</html>"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(staticDir, "pricing.html"), []byte("<html>pricing</html>"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(staticDir, "assets", "app-1a2b.js"), []byte("// app"), 0644))
+	config := defaultConfig()
+	config.StaticDir = staticDir
+	config.CleanURLs = true
+	handler := NewHandler(config)
+
+	tests := []struct {
+		path, wantBody, wantCacheControl string
+	}{
+		{"/pricing", "<html>pricing</html>", "public, max-age=3600"},
+		{"/pricing.html", "<html>pricing</html>", "public, max-age=3600"},
+		{"/docs/", "<html>docs</html>", "public, max-age=3600"},
+		{"/assets/app-1a2b.js", "// app", "public, max-age=31536000, immutable"},
+		// The fallback HTML is never cached, whatever the path it is served for
+		{"/", "<html>main</html>", "no-cache, no-store, must-revalidate"},
+		{"/users/1", "<html>main</html>", "no-cache, no-store, must-revalidate"},
+		{"/assets/", "<html>main</html>", "no-cache, no-store, must-revalidate"},
+		{"/assets/route", "<html>main</html>", "no-cache, no-store, must-revalidate"},
+	}
+	for _, tt := range tests {
+		rr := httptestGet(handler, tt.path)
+		assert.Equal(t, http.StatusOK, rr.Code, tt.path)
+		assert.Equal(t, tt.wantBody, rr.Body.String(), tt.path)
+		assert.Equal(t, tt.wantCacheControl, rr.Header().Get("Cache-Control"), tt.path)
+	}
+}
+
+func TestNewHandler_CleanURLsUnderBasePath(t *testing.T) {
+	staticDir := appDir(t, "main")
+	assert.NoError(t, os.MkdirAll(filepath.Join(staticDir, "docs"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(staticDir, "docs", "index.html"), []byte("<html>docs</html>"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(staticDir, "pricing.html"), []byte("<html>pricing</html>"), 0644))
+	config := defaultConfig()
+	config.StaticDir = staticDir
+	config.BasePath = "/app"
+	config.CleanURLs = true
+	handler := NewHandler(config)
+
+	// Redirects are relative, so they resolve under the base path
+	rr := httptestGet(handler, "/app/docs")
+	assert.Equal(t, http.StatusMovedPermanently, rr.Code)
+	assert.Equal(t, "docs/", rr.Header().Get("Location"))
+	rr = httptestGet(handler, "/app/pricing/")
+	assert.Equal(t, http.StatusMovedPermanently, rr.Code)
+	assert.Equal(t, "../pricing", rr.Header().Get("Location"))
+
+	assert.Equal(t, "<html>docs</html>", httptestGet(handler, "/app/docs/").Body.String())
+	assert.Equal(t, "<html>pricing</html>", httptestGet(handler, "/app/pricing").Body.String())
+}
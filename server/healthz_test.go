@@ -22,3 +22,21 @@ func TestHealthzHandler(t *testing.T) {
 			status, http.StatusOK)
 	}
 }
+
+func TestHealthzHandler_Draining(t *testing.T) {
+	draining.Store(true)
+	defer draining.Store(false)
+
+	req, err := http.NewRequest("GET", "/healthz", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(HealthzHandler).ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusServiceUnavailable {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusServiceUnavailable)
+	}
+}
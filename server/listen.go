@@ -0,0 +1,201 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Names under which listeners can be passed in via LISTEN_FDNAMES.
+const (
+	listenerNameHTTP     = "http"
+	listenerNameRedirect = "redirect"
+	listenerNameAdmin    = "admin"
+)
+
+// sdListenFdsStart is the first file descriptor passed by systemd socket activation.
+const sdListenFdsStart = 3
+
+// inheritedListeners holds listeners passed to the process by its parent.
+// Listeners whose name matches one of ours are used for that listener; all
+// others are handed out in the order they were passed.
+type inheritedListeners struct {
+	byName  map[string]net.Listener
+	ordered []net.Listener
+}
+
+// take returns the inherited listener for name, or nil if there is none.
+func (il *inheritedListeners) take(name string) net.Listener {
+	if il == nil {
+		return nil
+	}
+	if l, ok := il.byName[name]; ok {
+		delete(il.byName, name)
+		return l
+	}
+	if len(il.ordered) > 0 {
+		l := il.ordered[0]
+		il.ordered = il.ordered[1:]
+		return l
+	}
+	return nil
+}
+
+// closeUnused closes inherited listeners that were not taken.
+func (il *inheritedListeners) closeUnused() {
+	if il == nil {
+		return
+	}
+	for _, l := range il.byName {
+		l.Close()
+	}
+	for _, l := range il.ordered {
+		l.Close()
+	}
+}
+
+// systemdListeners returns the listeners passed by systemd socket activation,
+// or nil if the process was not socket activated. The LISTEN_* variables are
+// cleared so they are not inherited by child processes.
+func systemdListeners(fdStart int) (*inheritedListeners, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	return listenersFromFds(fdStart, count, names)
+}
+
+// listenersFromFds wraps count file descriptors starting at fdStart as listeners.
+func listenersFromFds(fdStart, count int, names []string) (*inheritedListeners, error) {
+	il := &inheritedListeners{byName: make(map[string]net.Listener)}
+	for i := 0; i < count; i++ {
+		file := os.NewFile(uintptr(fdStart+i), fmt.Sprintf("listener-%d", i))
+		listener, err := net.FileListener(file)
+		file.Close() // FileListener works on a duplicate
+		if err != nil {
+			il.closeUnused()
+			return nil, fmt.Errorf("inherited file descriptor %d is not a listening socket: %v", fdStart+i, err)
+		}
+		if i < len(names) && (names[i] == listenerNameHTTP || names[i] == listenerNameRedirect || names[i] == listenerNameAdmin) {
+			il.byName[names[i]] = listener
+		} else {
+			il.ordered = append(il.ordered, listener)
+		}
+	}
+	return il, nil
+}
+
+// listenUnix listens on the configured Unix domain socket, removing a stale
+// socket left behind by a previous process and applying the configured file
+// mode and owner.
+func listenUnix(config *Config) (net.Listener, error) {
+	path := config.UnixSocket
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.UnixSocketMode != "" {
+		mode, err := strconv.ParseUint(config.UnixSocketMode, 8, 32)
+		if err != nil {
+			listener.Close()
+			return nil, fmt.Errorf("invalid unix socket mode %q: %v", config.UnixSocketMode, err)
+		}
+		if err := os.Chmod(path, os.FileMode(mode)); err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+
+	if config.UnixSocketOwner != "" {
+		uid, gid, err := lookupOwner(config.UnixSocketOwner)
+		if err != nil {
+			listener.Close()
+			return nil, err
+		}
+		if err := os.Chown(path, uid, gid); err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+
+	return listener, nil
+}
+
+// removeStaleSocket removes the socket at path if no process is accepting
+// connections on it. Live sockets and other file types are left untouched.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use by another process", path)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return fmt.Errorf("checking socket %s: %v", path, err)
+	}
+	return os.Remove(path)
+}
+
+// lookupOwner resolves "user", "user:group", ":group" or their numeric forms
+// to a uid and gid. A missing part is returned as -1, leaving it unchanged.
+func lookupOwner(owner string) (int, int, error) {
+	userName, groupName, _ := strings.Cut(owner, ":")
+	uid, gid := -1, -1
+
+	if userName != "" {
+		id := userName
+		if _, err := strconv.Atoi(userName); err != nil {
+			u, err := user.Lookup(userName)
+			if err != nil {
+				return 0, 0, err
+			}
+			id = u.Uid
+		}
+		uid, _ = strconv.Atoi(id)
+	}
+
+	if groupName != "" {
+		id := groupName
+		if _, err := strconv.Atoi(groupName); err != nil {
+			g, err := user.LookupGroup(groupName)
+			if err != nil {
+				return 0, 0, err
+			}
+			id = g.Gid
+		}
+		gid, _ = strconv.Atoi(id)
+	}
+
+	return uid, gid, nil
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// unixClient returns an HTTP client that sends every request to socketPath.
+func unixClient(socketPath string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socketPath)
+		},
+	}}
+}
+
+func TestServe_UnixSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "spa.sock")
+
+	// Leave a stale socket behind, as a crashed process would
+	stale, err := net.Listen("unix", socketPath)
+	if !assert.NoError(t, err) {
+		return
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	cfg := &Config{UnixSocket: socketPath, UnixSocketMode: "0660"}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("over unix"))
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, cancel, cfg, handler)
+	}()
+
+	client := unixClient(socketPath)
+	var resp *http.Response
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if resp, err = client.Get("http://unix/"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if assert.NoError(t, err) {
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, "over unix", string(body))
+	}
+
+	info, err := os.Stat(socketPath)
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0660), info.Mode().Perm())
+	}
+
+	cancel()
+	assert.NoError(t, <-done)
+
+	_, err = os.Stat(socketPath)
+	assert.True(t, os.IsNotExist(err), "socket should be removed on shutdown")
+}
+
+func TestListenUnix_RefusesLiveSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "spa.sock")
+	live, err := net.Listen("unix", socketPath)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer live.Close()
+
+	_, err = listenUnix(&Config{UnixSocket: socketPath})
+	assert.Error(t, err)
+
+	regularFile := filepath.Join(t.TempDir(), "not-a-socket")
+	assert.NoError(t, os.WriteFile(regularFile, nil, 0644))
+	_, err = listenUnix(&Config{UnixSocket: regularFile})
+	assert.Error(t, err)
+}
+
+func TestSystemdListeners(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer tcp.Close()
+	file, err := tcp.(*net.TCPListener).File()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer file.Close()
+	fd := int(file.Fd())
+
+	t.Run("ignored when LISTEN_PID does not match", func(t *testing.T) {
+		t.Setenv("LISTEN_PID", "1")
+		t.Setenv("LISTEN_FDS", "1")
+
+		il, err := systemdListeners(fd)
+		assert.NoError(t, err)
+		assert.Nil(t, il)
+	})
+
+	t.Run("wraps passed file descriptors", func(t *testing.T) {
+		t.Setenv("LISTEN_PID", fmt.Sprint(os.Getpid()))
+		t.Setenv("LISTEN_FDS", "1")
+		t.Setenv("LISTEN_FDNAMES", "spa-server.socket")
+
+		il, err := systemdListeners(fd)
+		if !assert.NoError(t, err) || !assert.NotNil(t, il) {
+			return
+		}
+		assert.Equal(t, "", os.Getenv("LISTEN_FDS"), "LISTEN_FDS should be cleared")
+
+		listener := il.take(listenerNameHTTP)
+		if assert.NotNil(t, listener) {
+			assert.Equal(t, tcp.Addr().String(), listener.Addr().String())
+			listener.Close()
+		}
+		assert.Nil(t, il.take(listenerNameRedirect))
+	})
+}
+
+func TestLookupOwner(t *testing.T) {
+	uid, gid, err := lookupOwner("1000:1001")
+	assert.NoError(t, err)
+	assert.Equal(t, 1000, uid)
+	assert.Equal(t, 1001, gid)
+
+	uid, gid, err = lookupOwner(":1001")
+	assert.NoError(t, err)
+	assert.Equal(t, -1, uid)
+	assert.Equal(t, 1001, gid)
+
+	_, _, err = lookupOwner("no-such-user-for-spa-server")
+	assert.Error(t, err)
+}
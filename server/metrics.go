@@ -0,0 +1,121 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// requestMetrics holds the counters exposed by MetricsHandler.
+type requestMetrics struct {
+	mu              sync.Mutex
+	requestsByCode  map[int]uint64
+	durationSeconds float64
+	inFlight        atomic.Int64
+}
+
+var metrics = &requestMetrics{requestsByCode: make(map[int]uint64)}
+
+func (m *requestMetrics) observe(code int, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requestsByCode[code]++
+	m.durationSeconds += duration.Seconds()
+}
+
+// statusRecorder captures the status code written by the wrapped handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(statusCode int) {
+	if sr.status == 0 {
+		sr.status = statusCode
+	}
+	sr.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (sr *statusRecorder) Write(data []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	return sr.ResponseWriter.Write(data)
+}
+
+func (sr *statusRecorder) Flush() {
+	if flusher, ok := sr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the underlying ResponseWriter for use with http.ResponseController.
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// MetricsMiddleware counts requests by status code and records their duration.
+func MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		metrics.inFlight.Add(1)
+		defer metrics.inFlight.Add(-1)
+
+		start := time.Now()
+		sr := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(sr, r)
+		if sr.status == 0 {
+			sr.status = http.StatusOK
+		}
+		metrics.observe(sr.status, time.Since(start))
+	})
+}
+
+// MetricsHandler exposes the request metrics in the Prometheus text format.
+func MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	metrics.mu.Lock()
+	codes := make([]int, 0, len(metrics.requestsByCode))
+	var total uint64
+	for code, count := range metrics.requestsByCode {
+		codes = append(codes, code)
+		total += count
+	}
+	sort.Ints(codes)
+	counts := make([]uint64, len(codes))
+	for i, code := range codes {
+		counts[i] = metrics.requestsByCode[code]
+	}
+	durationSeconds := metrics.durationSeconds
+	metrics.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	fmt.Fprintln(w, "# HELP spa_http_requests_total Total number of HTTP requests served, by status code.")
+	fmt.Fprintln(w, "# TYPE spa_http_requests_total counter")
+	for i, code := range codes {
+		fmt.Fprintf(w, "spa_http_requests_total{code=\"%d\"} %d\n", code, counts[i])
+	}
+
+	fmt.Fprintln(w, "# HELP spa_http_request_duration_seconds Time spent serving HTTP requests.")
+	fmt.Fprintln(w, "# TYPE spa_http_request_duration_seconds summary")
+	fmt.Fprintf(w, "spa_http_request_duration_seconds_sum %g\n", durationSeconds)
+	fmt.Fprintf(w, "spa_http_request_duration_seconds_count %d\n", total)
+
+	fmt.Fprintln(w, "# HELP spa_http_requests_in_flight Number of HTTP requests currently being served.")
+	fmt.Fprintln(w, "# TYPE spa_http_requests_in_flight gauge")
+	fmt.Fprintf(w, "spa_http_requests_in_flight %d\n", metrics.inFlight.Load())
+
+	fmt.Fprintln(w, "# HELP spa_cached_assets Number of assets held in the in-memory cache.")
+	fmt.Fprintln(w, "# TYPE spa_cached_assets gauge")
+	fmt.Fprintf(w, "spa_cached_assets %d\n", cachedAssetCount())
+
+	drainingValue := 0
+	if draining.Load() {
+		drainingValue = 1
+	}
+	fmt.Fprintln(w, "# HELP spa_draining Whether the server is shutting down.")
+	fmt.Fprintln(w, "# TYPE spa_draining gauge")
+	fmt.Fprintf(w, "spa_draining %d\n", drainingValue)
+}
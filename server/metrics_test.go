@@ -0,0 +1,48 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// httptestGet runs a GET request for path against handler.
+func httptestGet(handler http.Handler, path string) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+	return rr
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	handler := MetricsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/teapot" {
+			w.WriteHeader(http.StatusTeapot)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+
+	metrics.mu.Lock()
+	before := metrics.requestsByCode[http.StatusTeapot]
+	metrics.mu.Unlock()
+
+	httptestGet(handler, "/")
+	httptestGet(handler, "/teapot")
+	httptestGet(handler, "/teapot")
+
+	metrics.mu.Lock()
+	assert.Equal(t, before+2, metrics.requestsByCode[http.StatusTeapot])
+	metrics.mu.Unlock()
+
+	rr := httptestGet(http.HandlerFunc(MetricsHandler), "/metrics")
+	assert.True(t, strings.HasPrefix(rr.Header().Get("Content-Type"), "text/plain"))
+	body := rr.Body.String()
+	assert.Contains(t, body, "# TYPE spa_http_requests_total counter")
+	assert.Contains(t, body, `spa_http_requests_total{code="418"}`)
+	assert.Contains(t, body, "spa_http_request_duration_seconds_count")
+	assert.Contains(t, body, "spa_http_requests_in_flight 0")
+	assert.Contains(t, body, "# TYPE spa_draining gauge")
+}
@@ -7,44 +7,53 @@ import (
 	"path/filepath"
 	"strings"
 
-	"github.com/andybalholm/brotli" // For Brotli compression
+	"github.com/NYTimes/gziphandler" // For gzip compression
+	"github.com/andybalholm/brotli"  // For Brotli compression
 )
 
 // cacheControlMiddleware sets appropriate Cache-Control headers for static assets.
 func CacheControlMiddleware(config *Config) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// For assets with content hashes (e.g., in /assets/ or with specific extensions)
-			// set a long cache duration and immutable.
-			if strings.HasPrefix(r.URL.Path, "/assets/") ||
-				strings.HasSuffix(r.URL.Path, ".js") ||
-				strings.HasSuffix(r.URL.Path, ".css") ||
-				strings.HasSuffix(r.URL.Path, ".png") ||
-				strings.HasSuffix(r.URL.Path, ".jpg") ||
-				strings.HasSuffix(r.URL.Path, ".jpeg") ||
-				strings.HasSuffix(r.URL.Path, ".gif") ||
-				strings.HasSuffix(r.URL.Path, ".svg") ||
-				strings.HasSuffix(r.URL.Path, ".webp") {
-				w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
-			} else if r.URL.Path == "/" || r.URL.Path == "/"+config.SpaFallbackFile {
-				// For index.html (or custom fallback), set no-cache to ensure fresh content on every visit
-				w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
-				w.Header().Set("Pragma", "no-cache")
-				w.Header().Set("Expires", "0")
-			} else {
-				// Check if the requested path corresponds to an actual file in the static directory.
-				// Only apply default cache control if it's a static file.
-				filePath := filepath.Join(config.StaticDir, r.URL.Path)
-				if _, err := os.Stat(filePath); err == nil { // File exists
-					w.Header().Set("Cache-Control", "public, max-age=3600")
-				}
-			}
+			setCacheControl(w.Header(), config, r.URL.Path)
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
+// setCacheControl sets the Cache-Control header for the file at urlPath in
+// the static directory.
+func setCacheControl(header http.Header, config *Config, urlPath string) {
+	// For assets with content hashes (e.g., in /assets/ or with specific extensions)
+	// set a long cache duration and immutable.
+	if strings.HasPrefix(urlPath, "/assets/") ||
+		strings.HasSuffix(urlPath, ".js") ||
+		strings.HasSuffix(urlPath, ".css") ||
+		strings.HasSuffix(urlPath, ".png") ||
+		strings.HasSuffix(urlPath, ".jpg") ||
+		strings.HasSuffix(urlPath, ".jpeg") ||
+		strings.HasSuffix(urlPath, ".gif") ||
+		strings.HasSuffix(urlPath, ".svg") ||
+		strings.HasSuffix(urlPath, ".webp") {
+		header.Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else if urlPath == "/" || urlPath == "/"+config.SpaFallbackFile {
+		// For index.html (or custom fallback), set no-cache to ensure fresh content on every visit
+		header.Set("Cache-Control", "no-cache, no-store, must-revalidate")
+		header.Set("Pragma", "no-cache")
+		header.Set("Expires", "0")
+	} else {
+		// Check if the requested path corresponds to an actual file in the static directory.
+		// Only apply default cache control if it's a static file.
+		filePath := filepath.Join(config.StaticDir, urlPath)
+		if _, err := os.Stat(filePath); err == nil { // File exists
+			header.Set("Cache-Control", "public, max-age=3600")
+		}
+	}
+}
+
 // brotliResponseWriter is a wrapper around http.ResponseWriter that compresses data with Brotli.
+// The Brotli writer is only created once a response with a body is started, so
+// that bodiless responses such as 304 Not Modified are passed through unencoded.
 type brotliResponseWriter struct {
 	http.ResponseWriter
 	brotliWriter *brotli.Writer
@@ -55,6 +64,9 @@ func (brw *brotliResponseWriter) Write(data []byte) (int, error) {
 	if !brw.wroteHeader {
 		brw.WriteHeader(http.StatusOK) // Ensure headers are written before first write
 	}
+	if brw.brotliWriter == nil {
+		return brw.ResponseWriter.Write(data)
+	}
 	return brw.brotliWriter.Write(data)
 }
 
@@ -62,10 +74,63 @@ func (brw *brotliResponseWriter) WriteHeader(statusCode int) {
 	if brw.wroteHeader {
 		return
 	}
-	brw.ResponseWriter.Header().Set("Content-Encoding", "br")
-	brw.ResponseWriter.Header().Set("Vary", "Accept-Encoding")
-	brw.ResponseWriter.WriteHeader(statusCode)
 	brw.wroteHeader = true
+
+	header := brw.ResponseWriter.Header()
+	addVary(header, "Accept-Encoding")
+	// Responses that are encoded already, such as precompressed files, pass
+	// through. Others get the ETag of their Brotli coding, and so does a 304
+	// Not Modified, which stands for the encoded response.
+	unencoded := header.Get("Content-Encoding") == ""
+	encode := unencoded && statusCode >= http.StatusOK && statusCode != http.StatusNoContent && statusCode != http.StatusNotModified
+	if etag := header.Get("ETag"); etag != "" && (encode || unencoded && statusCode == http.StatusNotModified) {
+		header.Set("ETag", encodedETag(etag, "br"))
+	}
+	if encode {
+		header.Set("Content-Encoding", "br")
+		// The length set by the handler describes the uncompressed body. Leaving it
+		// in place makes HTTP/1.1 clients wait for bytes that never arrive and
+		// HTTP/2 streams fail with a content-length mismatch.
+		header.Del("Content-Length")
+		brw.brotliWriter = brotli.NewWriter(brw.ResponseWriter)
+	}
+	brw.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Flush writes any buffered compressed data to the client, so that streamed
+// responses make progress over both HTTP/1.1 and HTTP/2.
+func (brw *brotliResponseWriter) Flush() {
+	if brw.brotliWriter != nil {
+		brw.brotliWriter.Flush()
+	}
+	if flusher, ok := brw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the underlying ResponseWriter for use with http.ResponseController.
+func (brw *brotliResponseWriter) Unwrap() http.ResponseWriter {
+	return brw.ResponseWriter
+}
+
+// close finishes the Brotli stream, if one was started.
+func (brw *brotliResponseWriter) close() error {
+	if brw.brotliWriter == nil {
+		return nil
+	}
+	return brw.brotliWriter.Close()
+}
+
+// addVary adds field to the Vary header unless it is listed already.
+func addVary(header http.Header, field string) {
+	for _, value := range header.Values("Vary") {
+		for _, f := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(f), field) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", field)
 }
 
 // BrotliHandler compresses responses with Brotli if the client supports it.
@@ -76,14 +141,80 @@ func BrotliHandler(next http.Handler) http.Handler {
 			return
 		}
 
-		brWriter := brotli.NewWriter(w)
-		defer brWriter.Close()
-
-		brw := &brotliResponseWriter{ResponseWriter: w, brotliWriter: brWriter}
+		// Conditional requests carry the ETag of the Brotli coding
+		stripEncodedETags(r, "br")
+		brw := &brotliResponseWriter{ResponseWriter: w}
+		defer brw.close()
 		next.ServeHTTP(brw, r)
 	})
 }
 
+// gzipETagWriter gives the responses gziphandler compresses an ETag of their
+// own. gziphandler only decides whether to compress once the body is written,
+// so below it, the ETag of a response without a Content-Encoding is marked as
+// gzip, and above it, with sent set, the mark is removed again from a response
+// that went out unencoded. A 304 Not Modified keeps the mark.
+type gzipETagWriter struct {
+	http.ResponseWriter
+	sent        bool
+	wroteHeader bool
+}
+
+func (gw *gzipETagWriter) Write(data []byte) (int, error) {
+	if !gw.wroteHeader {
+		gw.WriteHeader(http.StatusOK)
+	}
+	return gw.ResponseWriter.Write(data)
+}
+
+func (gw *gzipETagWriter) WriteHeader(statusCode int) {
+	if !gw.wroteHeader {
+		gw.wroteHeader = true
+		header := gw.ResponseWriter.Header()
+		etag, coding := header.Get("ETag"), header.Get("Content-Encoding")
+		switch {
+		case etag == "":
+		case !gw.sent && coding == "":
+			header.Set("ETag", encodedETag(etag, "gzip"))
+		case gw.sent && coding != "gzip" && statusCode != http.StatusNotModified:
+			header.Set("ETag", decodedETag(etag, "gzip"))
+		}
+	}
+	gw.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Flush passes on to the underlying ResponseWriter.
+func (gw *gzipETagWriter) Flush() {
+	if flusher, ok := gw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the underlying ResponseWriter for use with http.ResponseController.
+func (gw *gzipETagWriter) Unwrap() http.ResponseWriter {
+	return gw.ResponseWriter
+}
+
+// GzipHandler compresses responses with gzip if the client supports it, using
+// gziphandler, and gives the compressed responses an ETag of their own.
+func GzipHandler(next http.Handler) http.Handler {
+	gzipped := gziphandler.GzipHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if acceptsEncoding(r.Header.Get("Accept-Encoding"), "gzip") {
+			w = &gzipETagWriter{ResponseWriter: w}
+		}
+		next.ServeHTTP(w, r)
+	}))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !acceptsEncoding(r.Header.Get("Accept-Encoding"), "gzip") {
+			gzipped.ServeHTTP(w, r)
+			return
+		}
+		// Conditional requests carry the ETag of the gzip coding
+		stripEncodedETags(r, "gzip")
+		gzipped.ServeHTTP(&gzipETagWriter{ResponseWriter: w, sent: true}, r)
+	})
+}
+
 // CSPMiddleware sets the Content-Security-Policy header if configured.
 func CSPMiddleware(config *Config) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -144,4 +275,4 @@ func SecurityHeadersMiddleware(config *Config) func(http.Handler) http.Handler {
 			next.ServeHTTP(w, r)
 		})
 	}
-}
\ No newline at end of file
+}
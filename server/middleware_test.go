@@ -213,4 +213,148 @@ func TestCompression(t *testing.T) {
 			t.Errorf("body mismatch: got %q, want %q", rr.Body.String(), largeContent)
 		}
 	})
+
+	t.Run("should not apply compression to range requests", func(t *testing.T) {
+		for _, acceptEncoding := range []string{"br", "gzip"} {
+			req := httptest.NewRequest("GET", "/temp_large_file.txt", nil)
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+			req.Header.Set("Range", "bytes=0-1499")
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != http.StatusPartialContent {
+				t.Errorf("%s: handler returned wrong status code: got %v want %v", acceptEncoding, status, http.StatusPartialContent)
+			}
+			if contentEncoding := rr.Header().Get("Content-Encoding"); contentEncoding != "" {
+				t.Errorf("%s: Content-Encoding header should be empty, got %q", acceptEncoding, contentEncoding)
+			}
+			if contentRange := rr.Header().Get("Content-Range"); contentRange != "bytes 0-1499/2000" {
+				t.Errorf("%s: Content-Range header mismatch: got %q", acceptEncoding, contentRange)
+			}
+			if rr.Body.String() != largeContent[:1500] {
+				t.Errorf("%s: body mismatch: got %d bytes, want 1500", acceptEncoding, rr.Body.Len())
+			}
+		}
+	})
+}
+
+func TestCompression_ETags(t *testing.T) {
+	staticDir := t.TempDir()
+	largeContent := strings.Repeat("a", 2000)
+	if err := os.WriteFile(filepath.Join(staticDir, "app.js"), []byte(largeContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(staticDir, "small.js"), []byte("// small"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	handler := NewHandler(&Config{StaticDir: staticDir, SpaFallbackFile: "index.html"})
+
+	get := func(path string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		for i := 0; i < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	identity := get("/app.js").Header().Get("ETag")
+	if identity == "" {
+		t.Fatal("no ETag on the unencoded response")
+	}
+	etags := map[string]string{"": identity}
+	for _, coding := range []string{"br", "gzip"} {
+		rr := get("/app.js", "Accept-Encoding", coding)
+		if got := rr.Header().Get("Content-Encoding"); got != coding {
+			t.Fatalf("Content-Encoding mismatch: got %q, want %q", got, coding)
+		}
+		etag := rr.Header().Get("ETag")
+		if want := strings.TrimSuffix(identity, `"`) + "-" + coding + `"`; etag != want {
+			t.Errorf("%s: ETag mismatch: got %q, want %q", coding, etag, want)
+		}
+		etags[coding] = etag
+
+		// The encoded ETag validates the encoded response
+		rr = get("/app.js", "Accept-Encoding", coding, "If-None-Match", etag)
+		if rr.Code != http.StatusNotModified || rr.Header().Get("ETag") != etag {
+			t.Errorf("%s: If-None-Match: got %d with ETag %q, want 304 with %q", coding, rr.Code, rr.Header().Get("ETag"), etag)
+		}
+		if rr = get("/app.js", "Accept-Encoding", coding, "If-Match", etag); rr.Code != http.StatusOK {
+			t.Errorf("%s: If-Match: got %d, want 200", coding, rr.Code)
+		}
+
+		// Ranges are of the unencoded file, so the encoded ETag does not match
+		rr = get("/app.js", "Accept-Encoding", coding, "Range", "bytes=0-9", "If-Range", etag)
+		if rr.Code != http.StatusOK || rr.Body.String() != largeContent {
+			t.Errorf("%s: If-Range: got %d, want the full unencoded file", coding, rr.Code)
+		}
+	}
+	if etags[""] == etags["br"] || etags[""] == etags["gzip"] || etags["br"] == etags["gzip"] {
+		t.Errorf("codings share an ETag: %v", etags)
+	}
+
+	// The ETag of the Brotli coding does not validate the gzip coding
+	if rr := get("/app.js", "Accept-Encoding", "gzip", "If-None-Match", etags["br"]); rr.Code != http.StatusOK {
+		t.Errorf("If-None-Match with the Brotli ETag: got %d, want 200", rr.Code)
+	}
+
+	// gzip leaves small responses unencoded, along with their ETag
+	small := get("/small.js").Header().Get("ETag")
+	if rr := get("/small.js", "Accept-Encoding", "gzip"); rr.Header().Get("Content-Encoding") != "" || rr.Header().Get("ETag") != small {
+		t.Errorf("small file: got Content-Encoding %q and ETag %q, want none and %q",
+			rr.Header().Get("Content-Encoding"), rr.Header().Get("ETag"), small)
+	}
+}
+
+func TestBrotliHandler_ResponseHeaders(t *testing.T) {
+	t.Run("drops the uncompressed Content-Length", func(t *testing.T) {
+		content := strings.Repeat("b", 2000)
+		handler := BrotliHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Length", "2000")
+			w.Header().Set("Vary", "Origin")
+			w.Write([]byte(content))
+		}))
+
+		req := httptest.NewRequest("GET", "/file.txt", nil)
+		req.Header.Set("Accept-Encoding", "br")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Header().Get("Content-Length") != "" {
+			t.Errorf("Content-Length should be removed, got %q", rr.Header().Get("Content-Length"))
+		}
+		if got := rr.Header().Values("Vary"); len(got) != 2 || got[0] != "Origin" || got[1] != "Accept-Encoding" {
+			t.Errorf("Vary header mismatch: got %q", got)
+		}
+		body, err := ioutil.ReadAll(brotli.NewReader(rr.Body))
+		if err != nil {
+			t.Fatalf("failed to decompress body with Brotli: %v", err)
+		}
+		if string(body) != content {
+			t.Errorf("decompressed body mismatch")
+		}
+	})
+
+	t.Run("does not encode 304 responses", func(t *testing.T) {
+		handler := BrotliHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotModified)
+		}))
+
+		req := httptest.NewRequest("GET", "/file.txt", nil)
+		req.Header.Set("Accept-Encoding", "br")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNotModified {
+			t.Errorf("status mismatch: got %d", rr.Code)
+		}
+		if rr.Header().Get("Content-Encoding") != "" {
+			t.Errorf("Content-Encoding should be empty, got %q", rr.Header().Get("Content-Encoding"))
+		}
+		if rr.Body.Len() != 0 {
+			t.Errorf("body should be empty, got %d bytes", rr.Body.Len())
+		}
+	})
 }
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Mount serves another SPA under a path prefix, e.g. an admin app at /admin,
+// next to the top-level one. Requests are matched to the mount with the longest
+// prefix. Settings left empty are inherited from the top-level configuration.
+type Mount struct {
+	Prefix              string `json:"prefix" desc:"path prefix the app is served under, e.g. /admin"`
+	StaticDir           string `json:"static_dir" desc:"directory containing the built SPA"`
+	SpaFallbackFile     string `json:"spa_fallback_file,omitempty" desc:"file served for client-side routes"`
+	NotFoundFile        string `json:"not_found_file,omitempty" desc:"file in the mount's static directory served with 404 Not Found, not inherited"`
+	CSPHeader           string `json:"csp_header,omitempty" desc:"Content-Security-Policy header value"`
+	XContentTypeOptions string `json:"x_content_type_options,omitempty" desc:"X-Content-Type-Options header value"`
+	XFrameOptions       string `json:"x_frame_options,omitempty" desc:"X-Frame-Options header value"`
+	ReferrerPolicy      string `json:"referrer_policy,omitempty" desc:"Referrer-Policy header value"`
+	PermissionsPolicy   string `json:"permissions_policy,omitempty" desc:"Permissions-Policy header value"`
+}
+
+// pathPrefix returns the prefix without a trailing slash, e.g. "/admin".
+func (m Mount) pathPrefix() string {
+	return strings.TrimSuffix(m.Prefix, "/")
+}
+
+// config returns the configuration the mount's app is served with: base with
+// the mount's settings applied on top.
+func (m Mount) config(base *Config) *Config {
+	c := *base
+	c.Mounts = nil
+	c.StaticDir = m.StaticDir
+	c.NotFoundFile = m.NotFoundFile // names a file in the mount's own directory
+	overrides := []struct {
+		value  string
+		target *string
+	}{
+		{m.SpaFallbackFile, &c.SpaFallbackFile},
+		{m.CSPHeader, &c.CSPHeader},
+		{m.XContentTypeOptions, &c.XContentTypeOptions},
+		{m.XFrameOptions, &c.XFrameOptions},
+		{m.ReferrerPolicy, &c.ReferrerPolicy},
+		{m.PermissionsPolicy, &c.PermissionsPolicy},
+	}
+	for _, o := range overrides {
+		if o.value != "" {
+			*o.target = o.value
+		}
+	}
+	return &c
+}
+
+// validateMounts rejects mounts that cannot be routed: prefixes that are not
+// clean absolute paths, duplicates and mounts without a static directory.
+func validateMounts(mounts []Mount) error {
+	seen := make(map[string]bool)
+	for _, m := range mounts {
+		prefix := m.pathPrefix()
+		if prefix == "" {
+			return fmt.Errorf("invalid mount prefix %q: / is served by STATIC_DIR", m.Prefix)
+		}
+		if err := checkPathPrefix(prefix); err != nil {
+			return fmt.Errorf("invalid mount prefix %q: %v", m.Prefix, err)
+		}
+		switch {
+		case seen[prefix]:
+			return fmt.Errorf("duplicate mount prefix %q", m.Prefix)
+		case m.StaticDir == "":
+			return fmt.Errorf("mount %q has no static_dir", m.Prefix)
+		case strings.ContainsAny(m.SpaFallbackFile, "/\\"):
+			return fmt.Errorf("invalid spa_fallback_file for mount %q: %s", m.Prefix, m.SpaFallbackFile)
+		case strings.ContainsAny(m.NotFoundFile, "/\\"):
+			return fmt.Errorf("invalid not_found_file for mount %q: %s", m.Prefix, m.NotFoundFile)
+		}
+		seen[prefix] = true
+	}
+	return nil
+}
+
+// checkPathPrefix checks that prefix, without its trailing slash, can be
+// routed: a clean absolute path without the braces ServeMux uses for wildcards.
+func checkPathPrefix(prefix string) error {
+	if !strings.HasPrefix(prefix, "/") || path.Clean(prefix) != prefix {
+		return errors.New("must be a clean absolute path")
+	}
+	if strings.ContainsAny(prefix, "{} \t") {
+		return errors.New("must not contain braces or spaces")
+	}
+	return nil
+}
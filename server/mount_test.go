@@ -0,0 +1,151 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// appDir creates a static directory whose index.html contains name.
+func appDir(t *testing.T, name string) string {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html>"+name+"</html>"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "app.js"), []byte("// "+name), 0644))
+	return dir
+}
+
+func TestNewHandler_Mounts(t *testing.T) {
+	config := defaultConfig()
+	config.StaticDir = appDir(t, "main")
+	config.XFrameOptions = "SAMEORIGIN"
+	config.Mounts = []Mount{
+		{Prefix: "/admin", StaticDir: appDir(t, "admin"), CSPHeader: "default-src 'self'"},
+		{Prefix: "/admin/reports/", StaticDir: appDir(t, "reports")},
+	}
+	handler := NewHandler(config)
+
+	tests := []struct {
+		path, want string
+	}{
+		{"/", "<html>main</html>"},
+		{"/users/1", "<html>main</html>"},
+		{"/administrator", "<html>main</html>"},
+		{"/app.js", "// main"},
+		{"/admin/", "<html>admin</html>"},
+		{"/admin/users/1", "<html>admin</html>"},
+		{"/admin/app.js", "// admin"},
+		{"/admin/reports/", "<html>reports</html>"},
+		{"/admin/reports/2024/q1", "<html>reports</html>"},
+		{"/admin/reports/app.js", "// reports"},
+	}
+	for _, tt := range tests {
+		rr := httptestGet(handler, tt.path)
+		assert.Equal(t, http.StatusOK, rr.Code, tt.path)
+		assert.Equal(t, tt.want, rr.Body.String(), tt.path)
+	}
+
+	rr := httptestGet(handler, "/admin?tab=users")
+	assert.Equal(t, http.StatusMovedPermanently, rr.Code)
+	assert.Equal(t, "/admin/?tab=users", rr.Header().Get("Location"))
+
+	// Header settings are overridden per mount and otherwise inherited.
+	rr = httptestGet(handler, "/admin/")
+	assert.Equal(t, "default-src 'self'", rr.Header().Get("Content-Security-Policy"))
+	assert.Equal(t, "SAMEORIGIN", rr.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "no-cache, no-store, must-revalidate", rr.Header().Get("Cache-Control"))
+	rr = httptestGet(handler, "/users")
+	assert.Empty(t, rr.Header().Get("Content-Security-Policy"))
+}
+
+func TestNewHandler_MountCache(t *testing.T) {
+	t.Cleanup(func() {
+		for k := range inMemoryCache {
+			delete(inMemoryCache, k)
+		}
+	})
+	config := defaultConfig()
+	config.StaticDir = appDir(t, "main")
+	config.Mounts = []Mount{{Prefix: "/admin/", StaticDir: appDir(t, "admin")}}
+	assert.NoError(t, LoadCriticalAssetsIntoCache(config.StaticDir, config.Mounts...))
+
+	_, ok := GetCachedAsset("/admin/index.html")
+	assert.True(t, ok)
+
+	// Changes on disk are not seen while the cached copies are served.
+	assert.NoError(t, os.WriteFile(filepath.Join(config.StaticDir, "index.html"), []byte("changed"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(config.Mounts[0].StaticDir, "index.html"), []byte("changed"), 0644))
+	handler := NewHandler(config)
+	assert.Equal(t, "<html>main</html>", httptestGet(handler, "/").Body.String())
+	assert.Equal(t, "<html>admin</html>", httptestGet(handler, "/admin/").Body.String())
+}
+
+func TestValidateMounts(t *testing.T) {
+	tests := []struct {
+		mounts  []Mount
+		wantErr string
+	}{
+		{[]Mount{{Prefix: "/admin", StaticDir: "a"}, {Prefix: "/admin/reports", StaticDir: "b"}}, ""},
+		{[]Mount{{Prefix: "/", StaticDir: "a"}}, `invalid mount prefix "/": / is served by STATIC_DIR`},
+		{[]Mount{{Prefix: "admin", StaticDir: "a"}}, `invalid mount prefix "admin": must be a clean absolute path`},
+		{[]Mount{{Prefix: "/admin/../x", StaticDir: "a"}}, `invalid mount prefix "/admin/../x": must be a clean absolute path`},
+		{[]Mount{{Prefix: "/{id}", StaticDir: "a"}}, `invalid mount prefix "/{id}": must not contain braces or spaces`},
+		{[]Mount{{Prefix: "/admin", StaticDir: "a"}, {Prefix: "/admin/", StaticDir: "b"}}, `duplicate mount prefix "/admin/"`},
+		{[]Mount{{Prefix: "/admin"}}, `mount "/admin" has no static_dir`},
+		{[]Mount{{Prefix: "/admin", StaticDir: "a", SpaFallbackFile: "x/index.html"}}, `invalid spa_fallback_file for mount "/admin": x/index.html`},
+	}
+	for _, tt := range tests {
+		err := validateMounts(tt.mounts)
+		if tt.wantErr == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoadConfig_Mounts(t *testing.T) {
+	t.Setenv("ADMIN_DIST", "/srv/admin")
+	config, _, err := loadConfigFile(t, "config.yaml", `mounts:
+  - prefix: /admin
+    static_dir: ${ADMIN_DIST}
+    x_frame_options: SAMEORIGIN
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, []Mount{{Prefix: "/admin", StaticDir: "/srv/admin", XFrameOptions: "SAMEORIGIN"}}, config.Mounts)
+
+	_, _, err = loadConfigFile(t, "config.yaml", "mounts:\n  - prefix: /admin\n    static_dir: a\n    staticdir: b\n")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `config.yaml:1:1: unknown key "staticdir" in mounts`)
+	}
+
+	_, _, err = loadConfigFile(t, "config.json", `{"mounts": [{"prefix": "/", "static_dir": "a"}]}`)
+	assert.EqualError(t, err, `invalid mount prefix "/": / is served by STATIC_DIR`)
+
+	t.Setenv("MOUNTS", `[{"prefix": "/docs", "static_dir": "./docs"}]`)
+	config, sources, err := (&ConfigFlags{}).Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []Mount{{Prefix: "/docs", StaticDir: "./docs"}}, config.Mounts)
+	assert.Equal(t, "env MOUNTS", sources["mounts"])
+
+	t.Setenv("MOUNTS", `[{"prefix": "/docs", "dir": "./docs"}]`)
+	_, _, err = (&ConfigFlags{}).Load()
+	assert.Error(t, err)
+}
+
+func TestValidateConfig_Mounts(t *testing.T) {
+	config := &Config{
+		StaticDir:       validStaticDir(t),
+		SpaFallbackFile: "index.html",
+		Port:            8081,
+		Mounts: []Mount{
+			{Prefix: "/admin", StaticDir: validStaticDir(t), XFrameOptions: "ALLOW"},
+			{Prefix: "/docs", StaticDir: filepath.Join(t.TempDir(), "missing")},
+			{Prefix: "/help", StaticDir: validStaticDir(t), SpaFallbackFile: "help.html"},
+		},
+	}
+	report := ValidateConfig(config)
+	assert.Equal(t, []string{"mounts[0].x_frame_options", "mounts[1].static_dir", "mounts[2].spa_fallback_file"}, issueFields(report.Errors))
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// precompressedEncodings are the precompressed siblings of a file that are
+// looked for, e.g. app.js.br, in order of preference.
+var precompressedEncodings = []struct {
+	encoding string
+	ext      string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// servePrecompressed serves a precompressed sibling of the file at filePath if
+// there is one the client accepts, and reports whether it did. The response
+// keeps the Content-Type of the original file and is left alone by the runtime
+// compressors because its Content-Encoding is set.
+func servePrecompressed(w http.ResponseWriter, r *http.Request, filePath string) bool {
+	acceptEncoding := r.Header.Get("Accept-Encoding")
+	hasSibling := false
+	for _, pc := range precompressedEncodings {
+		info, err := os.Stat(filePath + pc.ext)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		hasSibling = true
+		if !acceptsEncoding(acceptEncoding, pc.encoding) {
+			continue
+		}
+		file, err := os.Open(filePath + pc.ext)
+		if err != nil {
+			continue
+		}
+		defer file.Close()
+
+		contentType := mime.TypeByExtension(filepath.Ext(filePath))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		header := w.Header()
+		addVary(header, "Accept-Encoding")
+		header.Set("Content-Type", contentType)
+		header.Set("Content-Encoding", pc.encoding)
+		if etag, err := fileETag(filePath+pc.ext, info); err == nil {
+			header.Set("ETag", etag)
+		}
+		http.ServeContent(w, r, filePath, info.ModTime(), file)
+		return true
+	}
+	if hasSibling {
+		// The response depends on Accept-Encoding even when the original is sent
+		addVary(w.Header(), "Accept-Encoding")
+	}
+	return false
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header allows coding,
+// either by name or through "*", honouring q=0 as a refusal.
+func acceptsEncoding(acceptEncoding, coding string) bool {
+	wildcard := false
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case coding:
+			return q > 0
+		case "*":
+			wildcard = q > 0
+		}
+	}
+	return wildcard
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcceptsEncoding(t *testing.T) {
+	tests := []struct {
+		header, coding string
+		want           bool
+	}{
+		{"", "br", false},
+		{"gzip, deflate, br", "br", true},
+		{"gzip, deflate", "br", false},
+		{"br;q=0, gzip", "br", false},
+		{"br; q=0.5", "br", true},
+		{"BR", "br", true},
+		{"*", "gzip", true},
+		{"*;q=0", "gzip", false},
+		{"gzip;q=0, *", "gzip", false},
+		{"brotli", "br", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, acceptsEncoding(tt.header, tt.coding), "%q accepts %s", tt.header, tt.coding)
+	}
+}
+
+// precompressedDir creates a static directory with app.js and its precompressed
+// siblings, whose contents name their encoding so the tests can tell them apart.
+func precompressedDir(t *testing.T) string {
+	dir := appDir(t, "main")
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "app.js.br"), []byte("brotli bytes"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "app.js.gz"), []byte("gzip bytes"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "plain.css"), []byte("body{}"), 0644))
+	return dir
+}
+
+func TestSpaHandler_Precompressed(t *testing.T) {
+	handler := CreateSpaHandler(&Config{StaticDir: precompressedDir(t), SpaFallbackFile: "index.html"})
+
+	tests := []struct {
+		acceptEncoding, wantEncoding, wantBody string
+	}{
+		{"gzip, deflate, br", "br", "brotli bytes"},
+		{"gzip", "gzip", "gzip bytes"},
+		{"br;q=0, gzip", "gzip", "gzip bytes"},
+		{"", "", "// main"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/app.js", nil)
+		req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code, tt.acceptEncoding)
+		assert.Equal(t, tt.wantBody, rr.Body.String(), tt.acceptEncoding)
+		assert.Equal(t, tt.wantEncoding, rr.Header().Get("Content-Encoding"), tt.acceptEncoding)
+		assert.Equal(t, "text/javascript; charset=utf-8", rr.Header().Get("Content-Type"), tt.acceptEncoding)
+		assert.Equal(t, []string{"Accept-Encoding"}, rr.Header().Values("Vary"), tt.acceptEncoding)
+	}
+
+	// Each encoding has its own ETag, and conditional requests work on it
+	req := httptest.NewRequest(http.MethodGet, "/app.js", nil)
+	req.Header.Set("Accept-Encoding", "br")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	brETag := rr.Header().Get("ETag")
+	assert.NotEqual(t, httptestGet(handler, "/app.js").Header().Get("ETag"), brETag)
+
+	req = httptest.NewRequest(http.MethodGet, "/app.js", nil)
+	req.Header.Set("Accept-Encoding", "br")
+	req.Header.Set("If-None-Match", brETag)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+
+	// Ranges of a precompressed response refer to its compressed bytes
+	req = httptest.NewRequest(http.MethodGet, "/app.js", nil)
+	req.Header.Set("Accept-Encoding", "br")
+	req.Header.Set("Range", "bytes=0-5")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusPartialContent, rr.Code)
+	assert.Equal(t, "br", rr.Header().Get("Content-Encoding"))
+	assert.Equal(t, "bytes 0-5/12", rr.Header().Get("Content-Range"))
+	assert.Equal(t, "brotli", rr.Body.String())
+
+	// Files without siblings are unaffected
+	req = httptest.NewRequest(http.MethodGet, "/plain.css", nil)
+	req.Header.Set("Accept-Encoding", "br")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, "body{}", rr.Body.String())
+	assert.Empty(t, rr.Header().Get("Content-Encoding"))
+	assert.Empty(t, rr.Header().Values("Vary"))
+}
+
+func TestNewHandler_PrecompressedBypassesCompressors(t *testing.T) {
+	config := defaultConfig()
+	config.StaticDir = precompressedDir(t)
+	handler := NewHandler(config)
+
+	for _, tt := range []struct{ acceptEncoding, wantEncoding, wantBody string }{
+		{"gzip, br", "br", "brotli bytes"},
+		{"gzip", "gzip", "gzip bytes"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/app.js", nil)
+		req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, tt.wantEncoding, rr.Header().Get("Content-Encoding"))
+		assert.Equal(t, tt.wantBody, rr.Body.String()) // sent as is, not compressed again
+		assert.Equal(t, []string{"Accept-Encoding"}, rr.Header().Values("Vary"))
+		assert.Equal(t, "public, max-age=31536000, immutable", rr.Header().Get("Cache-Control"))
+	}
+}
+
+func TestSpaHandler_PrecompressedCachedAsset(t *testing.T) {
+	t.Cleanup(func() {
+		for k := range inMemoryCache {
+			delete(inMemoryCache, k)
+		}
+	})
+	staticDir := appDir(t, "main")
+	assert.NoError(t, os.WriteFile(filepath.Join(staticDir, "vite.svg"), []byte("<svg></svg>"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(staticDir, "vite.svg.br"), []byte("brotli bytes"), 0644))
+	handler := CreateSpaHandler(&Config{StaticDir: staticDir, SpaFallbackFile: "index.html"})
+
+	serve := func(acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/vite.svg", nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// The cached copy is served the same way as the file on disk
+	for _, cached := range []bool{false, true} {
+		if cached {
+			assert.NoError(t, LoadCriticalAssetsIntoCache(staticDir))
+			_, ok := GetCachedAsset("/vite.svg")
+			assert.True(t, ok)
+		}
+
+		rr := serve("br")
+		assert.Equal(t, "brotli bytes", rr.Body.String(), "cached: %v", cached)
+		assert.Equal(t, "br", rr.Header().Get("Content-Encoding"), "cached: %v", cached)
+		assert.Equal(t, "image/svg+xml", rr.Header().Get("Content-Type"), "cached: %v", cached)
+		assert.Equal(t, []string{"Accept-Encoding"}, rr.Header().Values("Vary"), "cached: %v", cached)
+
+		rr = serve("gzip")
+		assert.Equal(t, "<svg></svg>", rr.Body.String(), "cached: %v", cached)
+		assert.Empty(t, rr.Header().Get("Content-Encoding"), "cached: %v", cached)
+		assert.Equal(t, []string{"Accept-Encoding"}, rr.Header().Values("Vary"), "cached: %v", cached)
+	}
+}
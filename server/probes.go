@@ -0,0 +1,158 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// probeCheck is a single named check run by a liveness or readiness probe.
+type probeCheck struct {
+	name  string
+	check func() error
+}
+
+// probeCheckResult is the outcome of one check in a probe response.
+type probeCheckResult struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+// probeResponse is the JSON body written by the probe endpoints. Without
+// ?verbose only failed checks are listed.
+type probeResponse struct {
+	Status string             `json:"status"`
+	Checks []probeCheckResult `json:"checks,omitempty"`
+}
+
+const (
+	probeStatusOK       = "ok"
+	probeStatusFailed   = "failed"
+	probeStatusExcluded = "excluded"
+)
+
+// LivezHandler reports whether the process is up. It keeps passing while the
+// server drains so that the orchestrator does not restart it mid-shutdown.
+func LivezHandler() http.Handler {
+	return probeHandler([]probeCheck{
+		{name: "ping", check: func() error { return nil }},
+	})
+}
+
+// ReadyzHandler reports whether the server can serve the SPA: it is not
+// shutting down, the static directory is readable, the SPA fallback file exists
+// and the critical assets have been loaded into the in-memory cache.
+func ReadyzHandler(config *Config) http.Handler {
+	checks := []probeCheck{
+		{name: "shutdown", check: checkNotDraining},
+		{name: "static-dir", check: func() error { return checkStaticDir(config.StaticDir) }},
+		{name: "fallback-file", check: func() error {
+			return checkFallbackFile(config.StaticDir, config.SpaFallbackFile)
+		}},
+	}
+	// Mounted apps are checked too, e.g. as static-dir:/admin
+	for _, m := range config.Mounts {
+		mountConfig := m.config(config)
+		checks = append(checks,
+			probeCheck{name: "static-dir:" + m.pathPrefix(), check: func() error {
+				return checkStaticDir(mountConfig.StaticDir)
+			}},
+			probeCheck{name: "fallback-file:" + m.pathPrefix(), check: func() error {
+				return checkFallbackFile(mountConfig.StaticDir, mountConfig.SpaFallbackFile)
+			}},
+		)
+	}
+	return probeHandler(append(checks, probeCheck{name: "cache", check: checkCacheLoaded}))
+}
+
+// probeHandler runs checks and responds with 200 if they all pass and 503
+// otherwise. Checks named in ?exclude= are skipped; ?verbose lists every check.
+func probeHandler(checks []probeCheck) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		_, verbose := query["verbose"]
+		excluded := make(map[string]bool)
+		for _, name := range query["exclude"] {
+			excluded[name] = true
+		}
+
+		response := probeResponse{Status: probeStatusOK}
+		for _, c := range checks {
+			if excluded[c.name] {
+				if verbose {
+					response.Checks = append(response.Checks, probeCheckResult{Name: c.name, Status: probeStatusExcluded})
+				}
+				continue
+			}
+
+			start := time.Now()
+			err := c.check()
+			result := probeCheckResult{
+				Name:     c.name,
+				Status:   probeStatusOK,
+				Duration: time.Since(start).String(),
+			}
+			if err != nil {
+				result.Status = probeStatusFailed
+				result.Error = err.Error()
+				response.Status = probeStatusFailed
+			}
+			if err != nil || verbose {
+				response.Checks = append(response.Checks, result)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if response.Status != probeStatusOK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(response)
+	})
+}
+
+func checkNotDraining() error {
+	if draining.Load() {
+		return errors.New("server is shutting down")
+	}
+	return nil
+}
+
+func checkStaticDir(staticDir string) error {
+	dir, err := os.Open(staticDir)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	if _, err := dir.Readdirnames(1); err != nil {
+		return fmt.Errorf("static directory %s is not readable: %w", staticDir, err)
+	}
+	return nil
+}
+
+func checkFallbackFile(staticDir, fallbackFile string) error {
+	info, err := os.Stat(filepath.Join(staticDir, fallbackFile))
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("SPA fallback file %s is a directory", fallbackFile)
+	}
+	return nil
+}
+
+func checkCacheLoaded() error {
+	if !cacheLoaded.Load() {
+		return errors.New("critical assets have not been loaded into the cache")
+	}
+	if cachedAssetCount() == 0 {
+		return errors.New("no critical assets could be loaded into the cache")
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeProbeResponse(t *testing.T, body []byte) probeResponse {
+	var response probeResponse
+	assert.NoError(t, json.Unmarshal(body, &response))
+	return response
+}
+
+func TestLivezHandler(t *testing.T) {
+	draining.Store(true)
+	defer draining.Store(false)
+
+	rr := httptestGet(LivezHandler(), "/livez?verbose")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	response := decodeProbeResponse(t, rr.Body.Bytes())
+	assert.Equal(t, "ok", response.Status)
+	if assert.Len(t, response.Checks, 1) {
+		assert.Equal(t, "ping", response.Checks[0].Name)
+	}
+}
+
+func TestReadyzHandler(t *testing.T) {
+	staticDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(staticDir, "index.html"), []byte("<html></html>"), 0644))
+	assert.NoError(t, LoadCriticalAssetsIntoCache(staticDir))
+	t.Cleanup(func() {
+		for k := range inMemoryCache {
+			delete(inMemoryCache, k)
+		}
+	})
+
+	t.Run("ready", func(t *testing.T) {
+		handler := ReadyzHandler(&Config{StaticDir: staticDir, SpaFallbackFile: "index.html"})
+		rr := httptestGet(handler, "/readyz")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+		response := decodeProbeResponse(t, rr.Body.Bytes())
+		assert.Equal(t, "ok", response.Status)
+		assert.Empty(t, response.Checks)
+	})
+
+	t.Run("verbose lists every check", func(t *testing.T) {
+		handler := ReadyzHandler(&Config{StaticDir: staticDir, SpaFallbackFile: "index.html"})
+		rr := httptestGet(handler, "/readyz?verbose")
+		response := decodeProbeResponse(t, rr.Body.Bytes())
+		var names []string
+		for _, c := range response.Checks {
+			names = append(names, c.Name)
+			assert.Equal(t, "ok", c.Status)
+			assert.NotEmpty(t, c.Duration)
+		}
+		assert.Equal(t, []string{"shutdown", "static-dir", "fallback-file", "cache"}, names)
+	})
+
+	t.Run("missing static dir", func(t *testing.T) {
+		handler := ReadyzHandler(&Config{StaticDir: filepath.Join(staticDir, "missing"), SpaFallbackFile: "index.html"})
+		rr := httptestGet(handler, "/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+		response := decodeProbeResponse(t, rr.Body.Bytes())
+		assert.Equal(t, "failed", response.Status)
+		var failed []string
+		for _, c := range response.Checks {
+			failed = append(failed, c.Name)
+			assert.NotEmpty(t, c.Error)
+		}
+		assert.Equal(t, []string{"static-dir", "fallback-file"}, failed)
+	})
+
+	t.Run("missing fallback file", func(t *testing.T) {
+		handler := ReadyzHandler(&Config{StaticDir: staticDir, SpaFallbackFile: "app.html"})
+		rr := httptestGet(handler, "/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	})
+
+	t.Run("excluded check", func(t *testing.T) {
+		handler := ReadyzHandler(&Config{StaticDir: staticDir, SpaFallbackFile: "app.html"})
+		rr := httptestGet(handler, "/readyz?exclude=fallback-file&verbose")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		response := decodeProbeResponse(t, rr.Body.Bytes())
+		for _, c := range response.Checks {
+			if c.Name == "fallback-file" {
+				assert.Equal(t, "excluded", c.Status)
+			}
+		}
+	})
+
+	t.Run("draining", func(t *testing.T) {
+		draining.Store(true)
+		defer draining.Store(false)
+		handler := ReadyzHandler(&Config{StaticDir: staticDir, SpaFallbackFile: "index.html"})
+		rr := httptestGet(handler, "/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	})
+}
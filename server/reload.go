@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// defaultConfigPollInterval is how often the config file is checked for changes.
+const defaultConfigPollInterval = 5 * time.Second
+
+// restartConfigKeys are the settings that only take effect when the process
+// restarts, because they shape the listeners rather than the handler chain.
+// Changes to them are logged on reload and otherwise ignored.
+var restartConfigKeys = map[string]bool{
+	"port":                     true,
+	"shutdown_delay_seconds":   true,
+	"shutdown_timeout_seconds": true,
+	"tls_cert_file":            true,
+	"tls_key_file":             true,
+	"http_redirect_port":       true,
+	"acme_domains":             true,
+	"acme_email":               true,
+	"acme_directory_url":       true,
+	"acme_cache_dir":           true,
+	"acme_ca_cert_file":        true,
+	"h2c":                      true,
+	"unix_socket":              true,
+	"unix_socket_mode":         true,
+	"unix_socket_owner":        true,
+	"admin_addr":               true,
+	"strict_startup":           true,
+}
+
+// swappableHandler forwards requests to a handler that can be replaced while
+// serving. Requests already in progress finish on the handler they started on.
+type swappableHandler struct {
+	current atomic.Pointer[http.Handler]
+}
+
+func (sh *swappableHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	(*sh.current.Load()).ServeHTTP(w, r)
+}
+
+func (sh *swappableHandler) store(handler http.Handler) {
+	sh.current.Store(&handler)
+}
+
+// configReloader reloads the configuration when the config file changes or
+// SIGHUP is received, and swaps the handler chains built from it. A config
+// that fails to load or validate is rejected and the previous one stays active.
+type configReloader struct {
+	fileWatcher
+	flags *ConfigFlags
+
+	mu     sync.Mutex // serialises reloads
+	config *Config
+	public swappableHandler
+	admin  swappableHandler
+}
+
+// newConfigReloader builds the handler chains for an already loaded config.
+func newConfigReloader(flags *ConfigFlags, config *Config) *configReloader {
+	cr := &configReloader{flags: flags, config: config}
+	cr.fileWatcher = newFileWatcher("configuration", defaultConfigPollInterval, cr.fileStamp, cr.reload)
+	cr.public.store(newHandler(config, assetsIn(currentAssetCache())))
+	cr.admin.store(AdminHandler(config))
+	return cr
+}
+
+// fileStamp returns a string that changes whenever a config file is
+// replaced, created or removed.
+func (cr *configReloader) fileStamp() string {
+	paths, err := cr.flags.configPaths()
+	if err != nil {
+		return "error"
+	}
+	return filesStamp(paths...)
+}
+
+// reload loads and validates the configuration and swaps it in on success.
+func (cr *configReloader) reload() error {
+	config, _, err := cr.flags.Load()
+	if err != nil {
+		return err
+	}
+	if report := ValidateConfig(config); !report.OK() {
+		return report
+	}
+
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	// Keep the settings that need a restart as they are.
+	previous := reflect.ValueOf(cr.config).Elem()
+	next := reflect.ValueOf(config).Elem()
+	for _, field := range configFields {
+		if !restartConfigKeys[field.key] {
+			continue
+		}
+		if !reflect.DeepEqual(previous.Field(field.index).Interface(), next.Field(field.index).Interface()) {
+			log.Printf("Config reload: %s changed, restart to apply it", field.key)
+		}
+		next.Field(field.index).Set(previous.Field(field.index))
+		config.setSecret(field.key, cr.config.secretKeys[field.key])
+	}
+
+	// The new handler chain serves the cache loaded for it, so a request sees
+	// either the old assets, config and handlers or the new ones. The cache
+	// is swapped in even if an asset could not be read, which is served from
+	// disk instead, so the new config goes live either way.
+	cache, err := buildAssetCache(config.StaticDirOrDefault(), config.Mounts...)
+	if err != nil {
+		log.Printf("Config reload: error loading critical assets into cache: %v", err)
+	}
+	cr.public.store(newHandler(config, assetsIn(cache)))
+	storeAssetCache(cache)
+	cr.admin.store(AdminHandler(config))
+	cr.config = config
+
+	log.Printf("Configuration reloaded")
+	return nil
+}
+
+// StartServerWithReload is like StartServer, but builds the handlers from config
+// itself and reloads the configuration through flags whenever the config file
+// changes or SIGHUP is received. Settings that shape the listeners, such as the
+// port or TLS files, still need a restart.
+func StartServerWithReload(config *Config, flags *ConfigFlags) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	reloader := newConfigReloader(flags, config)
+	reloader.watch(ctx)
+	return serveHandlers(ctx, stop, config, &reloader.public, &reloader.admin)
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestConfigReloader writes content to a YAML config file next to a static
+// directory containing index.html, and builds a reloader for it.
+func newTestConfigReloader(t *testing.T, content string) (*configReloader, string) {
+	dir := t.TempDir()
+	staticDir := filepath.Join(dir, "dist")
+	assert.NoError(t, os.Mkdir(staticDir, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(staticDir, "index.html"), []byte("<html></html>"), 0644))
+	t.Setenv("STATIC_DIR", staticDir)
+
+	configFile := filepath.Join(dir, "config.yaml")
+	assert.NoError(t, os.WriteFile(configFile, []byte(content), 0644))
+
+	flags := &ConfigFlags{configFiles: []string{configFile}}
+	config, _, err := flags.Load()
+	if err != nil {
+		t.Fatalf("loading config: %v", err)
+	}
+	return newConfigReloader(flags, config), configFile
+}
+
+// currentCSP returns the CSP header served by the reloader's public handler.
+func currentCSP(cr *configReloader) string {
+	return httptestGet(&cr.public, "/").Header().Get("Content-Security-Policy")
+}
+
+// writeConfig replaces the config file, making sure the change is detected
+// even if the modification time does not advance.
+func writeConfig(t *testing.T, path, content string) {
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	assert.NoError(t, os.Chtimes(path, time.Now(), info.ModTime().Add(time.Second)))
+}
+
+func TestConfigReloader_ReloadsChangedFile(t *testing.T) {
+	cr, configFile := newTestConfigReloader(t, "port: 9000\ncsp_header: \"default-src 'self'\"\n")
+	assert.Equal(t, "default-src 'self'", currentCSP(cr))
+
+	// Nothing changed, so nothing is reloaded.
+	cr.reloadIfChanged()
+	assert.Equal(t, "default-src 'self'", currentCSP(cr))
+
+	writeConfig(t, configFile, "port: 9001\ncsp_header: \"default-src 'none'\"\n")
+	cr.reloadIfChanged()
+	assert.Equal(t, "default-src 'none'", currentCSP(cr))
+
+	// The port needs a restart, so the admin config dump still shows the old one.
+	var dumped Config
+	assert.NoError(t, json.Unmarshal(httptestGet(&cr.admin, "/config").Body.Bytes(), &dumped))
+	assert.Equal(t, 9000, dumped.Port)
+	assert.Equal(t, "default-src 'none'", dumped.CSPHeader)
+}
+
+func TestConfigReloader_RejectsInvalidConfig(t *testing.T) {
+	cr, configFile := newTestConfigReloader(t, "csp_header: \"default-src 'self'\"\n")
+
+	for _, content := range []string{
+		"csp_header: \"default-src 'none'\"\nhsts_maxage: 60\n", // unknown key
+		"csp_header: \"default-src none\"\n",                    // fails validation
+		"csp_header: [\n",                                       // syntax error
+	} {
+		writeConfig(t, configFile, content)
+		cr.reloadIfChanged()
+		assert.Equal(t, "default-src 'self'", currentCSP(cr), "after reloading %q", content)
+	}
+
+	writeConfig(t, configFile, "csp_header: \"default-src 'none'\"\n")
+	cr.reloadIfChanged()
+	assert.Equal(t, "default-src 'none'", currentCSP(cr))
+}
+
+func TestConfigReloader_SwapsCacheWithHandler(t *testing.T) {
+	t.Cleanup(func() {
+		for k := range inMemoryCache {
+			delete(inMemoryCache, k)
+		}
+	})
+	cr, _ := newTestConfigReloader(t, "csp_header: \"default-src 'self'\"\n")
+	assert.NoError(t, cr.reload())
+	old := *cr.public.current.Load()
+
+	// Point the config at another build and reload
+	staticDir := appDir(t, "next")
+	t.Setenv("STATIC_DIR", staticDir)
+	assert.NoError(t, cr.reload())
+	_, cached := GetCachedAsset("/index.html")
+	assert.True(t, cached)
+
+	// A request still on the old handler gets the old build, not the new cache
+	assert.Equal(t, "<html></html>", httptestGet(old, "/").Body.String())
+	assert.Equal(t, "<html>next</html>", httptestGet(&cr.public, "/").Body.String())
+}
+
+func TestSwappableHandler_InFlightRequestsFinishOnOldHandler(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var sh swappableHandler
+	sh.store(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("old"))
+	}))
+
+	done := make(chan string)
+	go func() {
+		done <- httptestGet(&sh, "/").Body.String()
+	}()
+	<-started
+
+	sh.store(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("new"))
+	}))
+	assert.Equal(t, "new", httptestGet(&sh, "/").Body.String())
+
+	close(release)
+	assert.Equal(t, "old", <-done)
+}
@@ -0,0 +1,31 @@
+//go:build unix
+
+package server
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigReloader_ReloadsOnSIGHUP(t *testing.T) {
+	cr, configFile := newTestConfigReloader(t, "csp_header: \"default-src 'self'\"\n")
+	cr.interval = time.Hour // Only SIGHUP should trigger the reload
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cr.watch(ctx)
+
+	writeConfig(t, configFile, "csp_header: \"default-src 'none'\"\n")
+	assert.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && currentCSP(cr) != "default-src 'none'" {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, "default-src 'none'", currentCSP(cr))
+}
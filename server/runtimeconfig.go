@@ -0,0 +1,58 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"time"
+)
+
+// runtimeConfigValues returns what the runtime config route serves: the
+// RuntimeConfig values and the allowlisted environment variables that are set,
+// which take precedence.
+func runtimeConfigValues(config *Config) map[string]interface{} {
+	values := make(map[string]interface{}, len(config.RuntimeConfig)+len(config.RuntimeConfigVars))
+	for key, value := range config.RuntimeConfig {
+		values[key] = value
+	}
+	for _, name := range config.RuntimeConfigVars {
+		if value, ok := os.LookupEnv(name); ok {
+			values[name] = value
+		}
+	}
+	return values
+}
+
+// RuntimeConfigHandler serves the runtime config at config.RuntimeConfigPath:
+// as a script setting window.__ENV__ if the path ends in .js, as JSON
+// otherwise. The body is rendered once; clients revalidate it on every use
+// with its ETag.
+func RuntimeConfigHandler(config *Config) http.Handler {
+	body, err := json.Marshal(runtimeConfigValues(config))
+	if err != nil {
+		// The values were decoded from JSON or are strings, so this cannot happen
+		log.Printf("Error rendering runtime config: %v", err)
+		body = []byte("{}")
+	}
+	contentType := "application/json"
+	if path.Ext(config.RuntimeConfigPath) == ".js" {
+		body = []byte("window.__ENV__=" + string(body) + ";\n")
+		contentType = "text/javascript; charset=utf-8"
+	}
+	etag := contentETag(body)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(body))
+	})
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuntimeConfigHandler(t *testing.T) {
+	t.Setenv("SPATEST_API_URL", "https://api.example.com")
+	t.Setenv("SPATEST_SECRET", "hunter2")
+	config := &Config{
+		RuntimeConfigPath: "/env.js",
+		RuntimeConfigVars: []string{"SPATEST_API_URL", "SPATEST_UNSET"},
+		RuntimeConfig: map[string]interface{}{
+			"features":        map[string]interface{}{"beta": true},
+			"SPATEST_API_URL": "overridden by the environment",
+		},
+	}
+	handler := RuntimeConfigHandler(config)
+
+	rr := httptestGet(handler, "/env.js")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `window.__ENV__={"SPATEST_API_URL":"https://api.example.com","features":{"beta":true}};`+"\n", rr.Body.String())
+	assert.NotContains(t, rr.Body.String(), "hunter2")
+	assert.Equal(t, "text/javascript; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "no-cache", rr.Header().Get("Cache-Control"))
+	etag := rr.Header().Get("ETag")
+	assert.Regexp(t, `^"[0-9a-f]{32}"$`, etag)
+
+	req := httptest.NewRequest(http.MethodGet, "/env.js", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/env.js", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	assert.Equal(t, "GET, HEAD", rr.Header().Get("Allow"))
+
+	// A different value gets a different ETag
+	t.Setenv("SPATEST_API_URL", "https://staging.example.com")
+	assert.NotEqual(t, etag, httptestGet(RuntimeConfigHandler(config), "/env.js").Header().Get("ETag"))
+
+	config.RuntimeConfigPath = "/config.json"
+	rr = httptestGet(RuntimeConfigHandler(config), "/config.json")
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	var values map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &values))
+	assert.Equal(t, "https://staging.example.com", values["SPATEST_API_URL"])
+}
+
+func TestNewHandler_RuntimeConfigRoute(t *testing.T) {
+	t.Setenv("SPATEST_API_URL", "https://api.example.com")
+	config := defaultConfig()
+	config.StaticDir = appDir(t, "main")
+	config.BasePath = "/portal"
+	config.RuntimeConfigPath = "/env.js"
+	config.RuntimeConfigVars = []string{"SPATEST_API_URL"}
+	handler := NewHandler(config)
+
+	rr := httptestGet(handler, "/portal/env.js")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "https://api.example.com")
+	assert.Equal(t, "no-cache", rr.Header().Get("Cache-Control")) // not the long-lived caching of .js assets
+	assert.Equal(t, "nosniff", rr.Header().Get("X-Content-Type-Options"))
+
+	assert.Equal(t, "<html>main</html>", httptestGet(handler, "/portal/users").Body.String())
+}
+
+func TestLoadConfig_RuntimeConfig(t *testing.T) {
+	t.Setenv("SPATEST_REGION", "eu-west-1")
+	config, _, err := loadConfigFile(t, "config.yaml", `runtime_config_path: /config.json
+runtime_config_vars: [SPATEST_API_URL]
+runtime_config:
+  region: ${SPATEST_REGION}
+  max_upload: 12345678901234567890
+  features:
+    beta: true
+    regions: ["${SPATEST_REGION}", us-east-1]
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"SPATEST_API_URL"}, config.RuntimeConfigVars)
+	data, err := json.Marshal(config.RuntimeConfig)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"region": "eu-west-1", "max_upload": 12345678901234567890,
+		"features": {"beta": true, "regions": ["eu-west-1", "us-east-1"]}}`, string(data))
+	assert.Contains(t, string(data), "12345678901234567890")
+
+	_, _, err = loadConfigFile(t, "config.yaml", `runtime_config_path: /env.js
+mounts:
+  - prefix: /env.js/
+    static_dir: ./env
+`)
+	assert.EqualError(t, err, `RUNTIME_CONFIG_PATH /env.js conflicts with mount prefix "/env.js/"`)
+
+	t.Setenv("RUNTIME_CONFIG", `{"env": "staging"}`)
+	config, _, err = (&ConfigFlags{}).Load()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"env": "staging"}, config.RuntimeConfig)
+
+	for _, invalid := range []string{"env.js", "/env", "/env.txt", "/static/../env.js"} {
+		t.Setenv("RUNTIME_CONFIG_PATH", invalid)
+		_, _, err = (&ConfigFlags{}).Load()
+		assert.EqualError(t, err, "invalid RUNTIME_CONFIG_PATH: "+invalid+", expected a path ending in .js or .json")
+	}
+}
+
+func TestValidateConfig_RuntimeConfig(t *testing.T) {
+	config := &Config{StaticDir: validStaticDir(t), SpaFallbackFile: "index.html", Port: 8081,
+		RuntimeConfigVars: []string{"SPATEST_UNSET"}, RuntimeConfig: map[string]interface{}{"a": "b"}}
+	report := ValidateConfig(config)
+	assert.Equal(t, []string{"runtime_config_vars", "runtime_config"}, issueFields(report.Warnings))
+
+	config.RuntimeConfigPath = "/env.js"
+	report = ValidateConfig(config)
+	assert.Equal(t, []string{"runtime_config_vars"}, issueFields(report.Warnings))
+	assert.Contains(t, report.Warnings[0].Message, "SPATEST_UNSET is not set")
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runtimeEnv returns the environment variables whose names start with prefix.
+func runtimeEnv(prefix string) map[string]string {
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		if strings.HasPrefix(name, prefix) {
+			env[name] = value
+		}
+	}
+	return env
+}
+
+// runtimeEnvScript returns the body of the inline script that sets
+// window.__ENV__ from the environment variables starting with prefix, or nil
+// if prefix is empty. encoding/json escapes <, > and & in the values, so they
+// cannot close the script element.
+func runtimeEnvScript(prefix string) []byte {
+	if prefix == "" {
+		return nil
+	}
+	env, _ := json.Marshal(runtimeEnv(prefix)) // a map[string]string always marshals
+	return []byte("window.__ENV__=" + string(env) + ";")
+}
+
+// injectScript adds an inline script with the given body at the start of the
+// document's <head>, so it runs before the app's own scripts. Documents
+// without a <head> get it at the very start.
+func injectScript(doc, script []byte) []byte {
+	tag := []byte("<script>" + string(script) + "</script>")
+	at := 0
+	if loc := headTagPattern.FindIndex(doc); loc != nil {
+		at = loc[1]
+	}
+	return bytes.Join([][]byte{doc[:at], tag, doc[at:]}, nil)
+}
+
+// allowScriptHash adds the hash of an inline script to the script sources of a
+// Content-Security-Policy, so that the script may run. Without script-src or
+// default-src inline scripts are allowed already, and policies that allow them
+// with 'unsafe-inline' are left alone because a hash would disable it.
+func allowScriptHash(csp string, script []byte) string {
+	sum := sha256.Sum256(script)
+	source := "'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'"
+
+	directives := strings.Split(csp, ";")
+	var defaultSources []string
+	hasScriptSrc := false
+	for i, directive := range directives {
+		fields := strings.Fields(directive)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToLower(fields[0]) {
+		case "script-src", "script-src-elem":
+			hasScriptSrc = true
+			if !allowsAllInline(fields[1:]) {
+				directives[i] = strings.TrimRight(directive, " ") + " " + source
+			}
+		case "default-src":
+			defaultSources = fields[1:]
+		}
+	}
+	if hasScriptSrc || defaultSources == nil || allowsAllInline(defaultSources) {
+		return strings.Join(directives, ";")
+	}
+	// script-src replaces default-src for scripts, so carry its sources over
+	scriptSrc := fmt.Sprintf("script-src %s %s", strings.Join(defaultSources, " "), source)
+	return strings.TrimRight(strings.TrimSpace(csp), ";") + "; " + scriptSrc
+}
+
+// allowsAllInline reports whether a source list allows every inline script:
+// it has 'unsafe-inline' and no hash or nonce that would override it.
+func allowsAllInline(sources []string) bool {
+	unsafeInline := false
+	for _, s := range sources {
+		s = strings.ToLower(s)
+		if strings.HasPrefix(s, "'sha") || strings.HasPrefix(s, "'nonce-") {
+			return false
+		}
+		unsafeInline = unsafeInline || s == "'unsafe-inline'"
+	}
+	return unsafeInline
+}
+
+// fallbackRenderer returns the rewrites applied to the fallback HTML of the app
+// mounted at cachePrefix, or nil if there are none: the <base href> and the
+// runtime environment script.
+func fallbackRenderer(config *Config, cachePrefix string) func([]byte) []byte {
+	baseHref := ""
+	if config.RewriteBaseHref {
+		baseHref = config.basePath() + cachePrefix + "/"
+	}
+	envScript := runtimeEnvScript(config.RuntimeEnvPrefix)
+	if baseHref == "" && envScript == nil {
+		return nil
+	}
+	return func(doc []byte) []byte {
+		if envScript != nil {
+			doc = injectScript(doc, envScript)
+		}
+		if baseHref != "" {
+			doc = rewriteBaseHref(doc, baseHref)
+		}
+		return doc
+	}
+}
+
+// renderedFallback holds the fallback HTML as rendered and its ETag, so that
+// it is only rendered and hashed again once the file it came from changes.
+type renderedFallback struct {
+	render func([]byte) []byte
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	content []byte
+	etag    string
+}
+
+// get returns the rendering of the fallback HTML with the given modification
+// time and size, and its ETag. The HTML is only read, by calling read, when it
+// has not been rendered yet.
+func (rf *renderedFallback) get(modTime time.Time, size int64, read func() ([]byte, error)) ([]byte, string, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.etag != "" && rf.modTime.Equal(modTime) && rf.size == size {
+		return rf.content, rf.etag, nil
+	}
+	doc, err := read()
+	if err != nil {
+		return nil, "", err
+	}
+	rf.content = rf.render(doc)
+	rf.etag = contentETag(rf.content)
+	rf.modTime, rf.size = modTime, size
+	return rf.content, rf.etag, nil
+}
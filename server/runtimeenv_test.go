@@ -0,0 +1,161 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuntimeEnvScript(t *testing.T) {
+	assert.Nil(t, runtimeEnvScript(""))
+
+	t.Setenv("SPATEST_API_URL", "https://api.example.com")
+	t.Setenv("SPATEST_BANNER", "</script><script>alert(1)</script> & more")
+	t.Setenv("OTHER_SECRET", "hidden")
+	script := string(runtimeEnvScript("SPATEST_"))
+	assert.Equal(t, `window.__ENV__={"SPATEST_API_URL":"https://api.example.com",`+
+		`"SPATEST_BANNER":"\u003c/script\u003e\u003cscript\u003ealert(1)\u003c/script\u003e \u0026 more"};`, script)
+
+	assert.Equal(t, "window.__ENV__={};", string(runtimeEnvScript("SPATEST_NOTHING_")))
+}
+
+func TestInjectScript(t *testing.T) {
+	script := []byte("x=1;")
+	assert.Equal(t, `<html><head lang="en"><script>x=1;</script><title>App</title></head>`,
+		string(injectScript([]byte(`<html><head lang="en"><title>App</title></head>`), script)))
+	assert.Equal(t, `<script>x=1;</script><p>no head</p>`, string(injectScript([]byte(`<p>no head</p>`), script)))
+}
+
+func TestAllowScriptHash(t *testing.T) {
+	script := []byte("window.__ENV__={};")
+	sum := sha256.Sum256(script)
+	hash := "'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'"
+
+	tests := []struct {
+		csp, want string
+	}{
+		{"", ""},
+		{"img-src 'self'", "img-src 'self'"},
+		{"default-src 'self'; script-src 'self'", "default-src 'self'; script-src 'self' " + hash},
+		{"script-src 'self'; script-src-elem 'self' https://cdn.example.com", "script-src 'self' " + hash + "; script-src-elem 'self' https://cdn.example.com " + hash},
+		{"default-src 'self' https://cdn.example.com; img-src *", "default-src 'self' https://cdn.example.com; img-src *; script-src 'self' https://cdn.example.com " + hash},
+		{"default-src 'self';", "default-src 'self'; script-src 'self' " + hash},
+		{"script-src 'self' 'unsafe-inline'", "script-src 'self' 'unsafe-inline'"},
+		{"default-src 'unsafe-inline'", "default-src 'unsafe-inline'"},
+		{"script-src 'unsafe-inline' 'nonce-abc'", "script-src 'unsafe-inline' 'nonce-abc' " + hash},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, allowScriptHash(tt.csp, script), tt.csp)
+	}
+}
+
+func TestNewHandler_RuntimeEnv(t *testing.T) {
+	t.Cleanup(func() {
+		for k := range inMemoryCache {
+			delete(inMemoryCache, k)
+		}
+	})
+	staticDir := t.TempDir()
+	index := `<html><head><title>App</title></head></html>`
+	assert.NoError(t, os.WriteFile(filepath.Join(staticDir, "index.html"), []byte(index), 0644))
+
+	t.Setenv("SPATEST_API_URL", "https://api.example.com")
+	config := defaultConfig()
+	config.StaticDir = staticDir
+	config.CSPHeader = "default-src 'self'"
+	config.RuntimeEnvPrefix = "SPATEST_"
+	handler := NewHandler(config)
+
+	script := `window.__ENV__={"SPATEST_API_URL":"https://api.example.com"};`
+	want := `<html><head><script>` + script + `</script><title>App</title></head></html>`
+	sum := sha256.Sum256([]byte(script))
+	wantCSP := "default-src 'self'; script-src 'self' 'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'"
+
+	rr := httptestGet(handler, "/users/1")
+	assert.Equal(t, want, rr.Body.String())
+	assert.Equal(t, wantCSP, rr.Header().Get("Content-Security-Policy"))
+	diskETag := rr.Header().Get("ETag")
+	assert.Regexp(t, regexp.MustCompile(`^"[0-9a-f]{32}"$`), diskETag)
+
+	// The cached copy gets the same content and ETag
+	assert.NoError(t, LoadCriticalAssetsIntoCache(staticDir))
+	rr = httptestGet(handler, "/")
+	assert.Equal(t, want, rr.Body.String())
+	assert.Equal(t, diskETag, rr.Header().Get("ETag"))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("If-None-Match", diskETag)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+
+	// A different injected value changes the ETag, and If-Modified-Since does
+	// not override the mismatch even though the file is unchanged.
+	t.Setenv("SPATEST_API_URL", "https://staging.example.com")
+	handler = NewHandler(config)
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("If-None-Match", diskETag)
+	req.Header.Set("If-Modified-Since", time.Now().Add(time.Hour).Format(http.TimeFormat))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "https://staging.example.com")
+	assert.NotEqual(t, diskETag, rr.Header().Get("ETag"))
+
+	// Other files are served untouched
+	assert.NoError(t, os.WriteFile(filepath.Join(staticDir, "app.js"), []byte("// app"), 0644))
+	assert.Equal(t, "// app", httptestGet(handler, "/app.js").Body.String())
+}
+
+func TestRenderedFallback(t *testing.T) {
+	renders := 0
+	rf := &renderedFallback{render: func(doc []byte) []byte {
+		renders++
+		return append([]byte("rendered "), doc...)
+	}}
+	read := func(doc string) func() ([]byte, error) {
+		return func() ([]byte, error) { return []byte(doc), nil }
+	}
+	modTime := time.Now()
+
+	content, etag, err := rf.get(modTime, 5, read("first"))
+	assert.NoError(t, err)
+	assert.Equal(t, "rendered first", string(content))
+	assert.Equal(t, contentETag(content), etag)
+
+	// Later requests for the same file reuse the rendering
+	for i := 0; i < 3; i++ {
+		content, cached, err := rf.get(modTime, 5, read("first"))
+		assert.NoError(t, err)
+		assert.Equal(t, "rendered first", string(content))
+		assert.Equal(t, etag, cached)
+	}
+	assert.Equal(t, 1, renders)
+
+	// A changed file is rendered again
+	content, changed, err := rf.get(modTime.Add(time.Second), 6, read("second"))
+	assert.NoError(t, err)
+	assert.Equal(t, "rendered second", string(content))
+	assert.NotEqual(t, etag, changed)
+	assert.Equal(t, 2, renders)
+
+	// A file that cannot be read is reported and leaves the rendering as is
+	_, _, err = rf.get(modTime, 5, func() ([]byte, error) { return nil, os.ErrNotExist })
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+	assert.Equal(t, 2, renders)
+}
+
+func TestValidateConfig_RuntimeEnvPrefix(t *testing.T) {
+	config := &Config{StaticDir: validStaticDir(t), SpaFallbackFile: "index.html", Port: 8081, RuntimeEnvPrefix: "SPATEST_NOTHING_"}
+	report := ValidateConfig(config)
+	assert.Equal(t, []string{"runtime_env_prefix"}, issueFields(report.Warnings))
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// jsonSchema is the subset of JSON Schema (draft 2020-12) used to describe
+// the config file.
+type jsonSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Ref                  string                 `json:"$ref,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Default              interface{}            `json:"default,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	Examples             []string               `json:"examples,omitempty"`
+	Minimum              *int                   `json:"minimum,omitempty"`
+	Maximum              *int                   `json:"maximum,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties interface{}            `json:"additionalProperties,omitempty"`
+}
+
+// schemaDefaults are defaults applied after loading, where the zero value in
+// Config stands for them.
+var schemaDefaults = map[string]interface{}{
+	"static_dir":             DefaultStaticDir,
+	"x_content_type_options": "nosniff",
+	"x_frame_options":        "DENY",
+	"referrer_policy":        "no-referrer-when-downgrade",
+}
+
+// schemaEnums lists the allowed values of settings other than header values.
+var schemaEnums = map[string][]string{
+	"fallback_mode": {FallbackNavigation, FallbackAlways},
+}
+
+// portKeys are the settings holding a TCP port.
+var portKeys = map[string]bool{"port": true, "http_redirect_port": true}
+
+// configSchema returns a JSON Schema describing the config file, generated
+// from the Config fields, their defaults and the header values ValidateConfig
+// accepts. Each field's schema is also referenced from the profiles section.
+func configSchema() *jsonSchema {
+	defaults := reflect.ValueOf(defaultConfig()).Elem()
+	t := defaults.Type()
+
+	properties := map[string]*jsonSchema{
+		schemaKey: {Description: "URI of this schema, ignored by the server.", Type: "string"},
+	}
+	profile := map[string]*jsonSchema{}
+	for _, field := range configFields {
+		s := fieldSchema(t.Field(field.index).Type, field.key)
+		s.Description = describeField(field)
+		if def, ok := schemaDefaults[field.key]; ok {
+			s.Default = def
+		} else if v := defaults.Field(field.index); !v.IsZero() {
+			s.Default = v.Interface()
+		}
+		properties[field.key] = s
+		profile[field.key] = &jsonSchema{Ref: "#/properties/" + field.key}
+	}
+	properties[profilesKey] = &jsonSchema{
+		Description: "Overlays selected with " + profileEnv + " or --profile and merged over the top-level settings.",
+		Type:        "object",
+		AdditionalProperties: &jsonSchema{
+			Type:                 "object",
+			Properties:           profile,
+			AdditionalProperties: false,
+		},
+	}
+
+	return &jsonSchema{
+		Schema:               "https://json-schema.org/draft/2020-12/schema",
+		Title:                "go-react-spa-server configuration",
+		Description:          "Config file for go-react-spa-server, in JSON, YAML or TOML.",
+		Type:                 "object",
+		Properties:           properties,
+		AdditionalProperties: false,
+	}
+}
+
+// fieldSchema returns the type and constraints of the field with the given key.
+func fieldSchema(typ reflect.Type, key string) *jsonSchema {
+	switch typ.Kind() {
+	case reflect.Int:
+		s := &jsonSchema{Type: "integer", Minimum: new(int)}
+		if portKeys[key] {
+			max := 65535
+			s.Maximum = &max
+		}
+		return s
+	case reflect.Bool:
+		return &jsonSchema{Type: "boolean"}
+	case reflect.Slice:
+		return &jsonSchema{Type: "array", Items: fieldSchema(typ.Elem(), key)}
+	case reflect.Struct:
+		return objectSchema(typ)
+	case reflect.Map:
+		return &jsonSchema{Type: "object"}
+	}
+
+	s := &jsonSchema{Type: "string"}
+	if enum, ok := schemaEnums[key]; ok {
+		s.Enum = enum
+		return s
+	}
+	valid, ok := validHeaderValues[key]
+	if !ok {
+		return s
+	}
+	// ValidateConfig accepts header values in any case, which an enum cannot
+	// express, so they are matched by a pattern instead.
+	alternatives := make([]string, len(valid))
+	for i, v := range valid {
+		alternatives[i] = caseInsensitivePattern(v)
+	}
+	value := `\s*(?:` + strings.Join(alternatives, "|") + `)\s*`
+	if key == "referrer_policy" {
+		// Referrer-Policy may list fallbacks separated by commas.
+		s.Pattern = "^" + value + "(?:," + value + ")*$"
+	} else {
+		s.Pattern = "^" + value + "$"
+	}
+	s.Examples = valid
+	return s
+}
+
+// caseInsensitivePattern returns a regular expression matching s in any case.
+// JSON Schema patterns have no flag for it, so each letter becomes a
+// character class, e.g. [dD][eE][nN][yY].
+func caseInsensitivePattern(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		upper, lower := unicode.ToUpper(r), unicode.ToLower(r)
+		if upper == lower {
+			b.WriteString(regexp.QuoteMeta(string(r)))
+			continue
+		}
+		b.WriteString("[" + string(lower) + string(upper) + "]")
+	}
+	return b.String()
+}
+
+// objectSchema describes a struct such as Mount, whose fields without
+// omitempty are required.
+func objectSchema(typ reflect.Type) *jsonSchema {
+	s := &jsonSchema{Type: "object", Properties: map[string]*jsonSchema{}, AdditionalProperties: false}
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		tag := strings.Split(f.Tag.Get("json"), ",")
+		key := tag[0]
+		property := fieldSchema(f.Type, key)
+		property.Description = sentence(f.Tag.Get("desc"))
+		s.Properties[key] = property
+		if len(tag) == 1 {
+			s.Required = append(s.Required, key)
+		}
+	}
+	return s
+}
+
+// describeField turns a field's flag usage into a sentence naming the
+// environment variable and flag that also set it.
+func describeField(field configField) string {
+	desc := sentence(field.desc)
+	if field.env == "" {
+		return desc + " Flag --" + field.flag + "."
+	}
+	return desc + " Environment variable " + field.env + ", flag --" + field.flag + "."
+}
+
+// sentence capitalises a flag usage string and ends it with a full stop.
+func sentence(usage string) string {
+	return strings.ToUpper(usage[:1]) + usage[1:] + "."
+}
+
+// WriteConfigSchema writes the config file's JSON Schema to w.
+func WriteConfigSchema(w io.Writer) error {
+	data, err := json.MarshalIndent(configSchema(), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestConfigSchema_UpToDate keeps the committed schema in sync with Config.
+func TestConfigSchema_UpToDate(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, WriteConfigSchema(&buf))
+
+	committed, err := ioutil.ReadFile("../config.schema.json")
+	assert.NoError(t, err)
+	if !assert.Equal(t, string(committed), buf.String()) {
+		t.Log("config.schema.json is out of date, regenerate it with: go run . schema > config.schema.json")
+	}
+}
+
+func TestConfigSchema(t *testing.T) {
+	schema := configSchema()
+	assert.Equal(t, false, schema.AdditionalProperties)
+	for _, field := range configFields {
+		s, ok := schema.Properties[field.key]
+		if assert.True(t, ok, "no schema for %s", field.key) {
+			assert.Contains(t, s.Description, field.env)
+			assert.Contains(t, s.Description, "--"+field.flag)
+		}
+	}
+
+	assert.Equal(t, "integer", schema.Properties["port"].Type)
+	assert.Equal(t, 8081, schema.Properties["port"].Default)
+	assert.Equal(t, 65535, *schema.Properties["port"].Maximum)
+	assert.Equal(t, "boolean", schema.Properties["h2c"].Type)
+	assert.Equal(t, "array", schema.Properties["acme_domains"].Type)
+	assert.Equal(t, DefaultStaticDir, schema.Properties["static_dir"].Default)
+	assert.Equal(t, []string{"DENY", "SAMEORIGIN"}, schema.Properties["x_frame_options"].Examples)
+	assert.Equal(t, []string{"nosniff"}, schema.Properties["x_content_type_options"].Examples)
+
+	policy := regexp.MustCompile(schema.Properties["referrer_policy"].Pattern)
+	assert.True(t, policy.MatchString("no-referrer"))
+	assert.True(t, policy.MatchString("no-referrer, strict-origin-when-cross-origin"))
+	assert.False(t, policy.MatchString("nope"))
+	assert.False(t, policy.MatchString("no-referrer,"))
+
+	profiles := schema.Properties["profiles"].AdditionalProperties.(*jsonSchema)
+	assert.Equal(t, "#/properties/port", profiles.Properties["port"].Ref)
+	assert.NotContains(t, profiles.Properties, "profiles")
+}
+
+// TestConfigSchema_AgreesWithValidateConfig checks that the schema accepts
+// exactly the header values ValidateConfig accepts.
+func TestConfigSchema_AgreesWithValidateConfig(t *testing.T) {
+	schema := configSchema()
+	tests := []struct {
+		key   string
+		value string
+	}{
+		{"x_frame_options", "DENY"},
+		{"x_frame_options", "sameorigin"},
+		{"x_frame_options", "SameOrigin"},
+		{"x_frame_options", " DENY "},
+		{"x_frame_options", "DENY, SAMEORIGIN"},
+		{"x_frame_options", "ALLOW-FROM https://example.com"},
+		{"x_content_type_options", "NoSniff"},
+		{"x_content_type_options", "sniff"},
+		{"referrer_policy", "No-Referrer"},
+		{"referrer_policy", "no-referrer, STRICT-ORIGIN-WHEN-CROSS-ORIGIN"},
+		{"referrer_policy", "no-referrer,"},
+		{"referrer_policy", "never"},
+	}
+	for _, tt := range tests {
+		config := &Config{}
+		for _, field := range configFields {
+			if field.key == tt.key {
+				reflect.ValueOf(config).Elem().Field(field.index).SetString(tt.value)
+			}
+		}
+		report := &ValidationReport{}
+		validateHeaderValues(report, config)
+		pattern := regexp.MustCompile(schema.Properties[tt.key].Pattern)
+		assert.Equal(t, report.OK(), pattern.MatchString(tt.value), "%s: %q", tt.key, tt.value)
+	}
+}
+
+func TestConfigSchema_IsValidJSON(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, WriteConfigSchema(&buf))
+	var doc map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &doc))
+	assert.Equal(t, "https://json-schema.org/draft/2020-12/schema", doc["$schema"])
+}
+
+func TestConfigFile_SchemaKeyIgnored(t *testing.T) {
+	config, _, err := loadConfigFile(t, "config.json", `{"$schema": "./config.schema.json", "port": 9000}`)
+	assert.NoError(t, err)
+	assert.Equal(t, 9000, config.Port)
+
+	// Only at the top level; profiles take settings alone.
+	_, _, err = loadConfigFile(t, "config.json", `{"profiles": {"prod": {"$schema": "x"}}}`)
+	assert.Error(t, err)
+}
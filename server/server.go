@@ -1,18 +1,360 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt" // Added import
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
-	"github.com/NYTimes/gziphandler" // For gzip compression
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
-// StartServer encapsulates the server startup logic.
+// Errors returned by StartServer, identifying the phase in which it failed.
+var (
+	ErrListen   = errors.New("failed to listen")
+	ErrServe    = errors.New("server error")
+	ErrShutdown = errors.New("graceful shutdown failed")
+)
+
+// draining is set once a shutdown signal has been received so that health
+// checks start failing while in-flight requests are still being served.
+var draining atomic.Bool
+
+// StartServer encapsulates the server startup logic. It serves until SIGINT or
+// SIGTERM is received, then drains in-flight requests before returning.
 func StartServer(config *Config, handler http.Handler) error {
-	addr := fmt.Sprintf(":%d", config.Port) // Construct address from config.Port
-	log.Printf("Listening on %s...", addr)
-	return http.ListenAndServe(addr, handler)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return serve(ctx, stop, config, handler)
+}
+
+// serve runs the HTTP server, and the optional HTTP-to-HTTPS redirect and admin servers,
+// until ctx is cancelled and then shuts them down. stop is called once
+// shutdown begins so that a second signal terminates the process immediately
+// instead of waiting for the drain to finish. On SIGUSR2 the listeners are
+// handed to a newly started copy of the binary and this process drains.
+func serve(ctx context.Context, stop context.CancelFunc, config *Config, handler http.Handler) error {
+	return serveHandlers(ctx, stop, config, handler, AdminHandler(config))
+}
+
+// serveHandlers is serve with the handler for the admin listener given explicitly.
+func serveHandlers(ctx context.Context, stop context.CancelFunc, config *Config, handler, adminHandler http.Handler) error {
+	servers, err := newServers(ctx, config, handler, adminHandler)
+	if err != nil {
+		return err
+	}
+	draining.Store(false)
+
+	for _, s := range servers {
+		s.server.ConnState = s.trackNewConns
+	}
+
+	serveErr := make(chan error, len(servers))
+	for _, s := range servers {
+		s.done = make(chan struct{})
+		go func() {
+			defer close(s.done)
+			serveErr <- s.serve()
+		}()
+		log.Printf("Listening on %s (%s)...", s.listener.Addr(), s.name)
+	}
+	if err := notifyUpgradeReady(); err != nil {
+		log.Printf("Error notifying parent process of readiness: %v", err)
+	}
+
+	upgrade := make(chan os.Signal, 1)
+	if len(upgradeSignals) > 0 {
+		signal.Notify(upgrade, upgradeSignals...)
+		defer signal.Stop(upgrade)
+	}
+
+	for {
+		select {
+		case err := <-serveErr:
+			for _, s := range servers {
+				s.server.Close()
+			}
+			return fmt.Errorf("%w: %v", ErrServe, err)
+		case <-ctx.Done():
+			stop()
+			return shutdown(servers, config, true)
+		case <-upgrade:
+			log.Printf("Upgrade signal received")
+			if err := startUpgrade(servers); err != nil {
+				log.Printf("Upgrade failed, continuing to serve: %v", err)
+				continue
+			}
+			// The new process already serves on the same sockets, so there is
+			// no need to wait for load balancers before draining.
+			return shutdown(servers, config, false)
+		}
+	}
+}
+
+// listeningServer pairs an http.Server with the listener it serves on.
+type listeningServer struct {
+	name         string
+	listenerName string // Name used when passing the listener to another process
+	server       *http.Server
+	listener     net.Listener
+	done         chan struct{} // Closed when serve returns
+
+	mu       sync.Mutex
+	newConns map[net.Conn]struct{}
+
+	// hijackedRequests counts requests in flight on h2c connections, which
+	// http.Server.Shutdown does not wait for.
+	hijackedRequests atomic.Int64
+}
+
+func (s *listeningServer) serve() error {
+	if s.server.TLSConfig != nil {
+		return s.server.ServeTLS(s.listener, "", "")
+	}
+	return s.server.Serve(s.listener)
+}
+
+// newConnGracePeriod bounds how long draining waits for connections that were
+// accepted but have not sent their first request yet.
+const newConnGracePeriod = time.Second
+
+// trackNewConns records connections that were accepted but have not sent
+// their first request yet. It is used as http.Server.ConnState.
+func (s *listeningServer) trackNewConns(conn net.Conn, state http.ConnState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state == http.StateNew {
+		if s.newConns == nil {
+			s.newConns = make(map[net.Conn]struct{})
+		}
+		s.newConns[conn] = struct{}{}
+	} else {
+		delete(s.newConns, conn)
+	}
+}
+
+func (s *listeningServer) pendingNewConns() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.newConns)
+}
+
+// trackHijackedRequests wraps the handler given to h2c.NewHandler, counting
+// the HTTP/2 requests it serves on connections taken over from the server.
+func (s *listeningServer) trackHijackedRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 {
+			s.hijackedRequests.Add(1)
+			defer s.hijackedRequests.Add(-1)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// drain gracefully shuts the server down. http.Server.Shutdown closes
+// connections whose first request arrives after shutdown started, which drops
+// requests on connections accepted just before the listener closed. To avoid
+// this, drain stops accepting first and gives such connections a short grace
+// period to send their request before shutting down. It then also waits for
+// the requests on h2c connections, which Shutdown does not track.
+func (s *listeningServer) drain(ctx context.Context) error {
+	if s.done != nil {
+		s.listener.Close()
+		select {
+		case <-s.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		grace := time.NewTimer(newConnGracePeriod)
+		defer grace.Stop()
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+	wait:
+		for s.pendingNewConns() > 0 {
+			select {
+			case <-ticker.C:
+			case <-grace.C:
+				break wait
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	if err := s.server.Shutdown(ctx); err != nil {
+		return err
+	}
+
+	// Shutdown has sent GOAWAY on h2c connections but does not wait for them
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for s.hijackedRequests.Load() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// newServers opens the listeners described by config, preferring listeners
+// passed in by systemd socket activation or by a parent process during an
+// upgrade. The main server listens on the Unix socket if one is configured and
+// on Port otherwise, and serves handler over HTTPS when a certificate is
+// configured and plain HTTP otherwise. adminHandler is served on AdminAddr.
+func newServers(ctx context.Context, config *Config, handler, adminHandler http.Handler) ([]*listeningServer, error) {
+	primary := &listeningServer{name: "http", listenerName: listenerNameHTTP, server: &http.Server{Handler: handler}}
+	redirectHandler := HTTPSRedirectHandler(config.Port)
+
+	switch {
+	case config.ACMEEnabled():
+		manager, err := newACMEManager(config)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrListen, err)
+		}
+		primary.name = "https"
+		primary.server.TLSConfig = manager.TLSConfig()
+		primary.server.TLSConfig.MinVersion = tls.VersionTLS12
+		// Answer HTTP-01 challenges before redirecting everything else.
+		redirectHandler = manager.HTTPHandler(redirectHandler)
+	case config.TLSEnabled():
+		tlsConfig, err := loadTLSConfig(ctx, config)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrListen, err)
+		}
+		primary.name = "https"
+		primary.server.TLSConfig = tlsConfig
+	case config.H2C:
+		// Accept cleartext HTTP/2 alongside HTTP/1.1 for proxies that speak it to the pod.
+		// Registering the HTTP/2 server makes Shutdown send GOAWAY on h2c
+		// connections, which are hijacked and so not closed by Shutdown itself.
+		h2s := &http2.Server{}
+		if err := http2.ConfigureServer(primary.server, h2s); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrListen, err)
+		}
+		primary.server.TLSConfig = nil // set up by ConfigureServer, but h2c is cleartext
+		primary.name = "http, h2c"
+		primary.server.Handler = h2c.NewHandler(primary.trackHijackedRequests(handler), h2s)
+	}
+
+	inherited, err := systemdListeners(sdListenFdsStart)
+	if err == nil && inherited == nil {
+		inherited, err = upgradeListeners()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrListen, err)
+	}
+	defer inherited.closeUnused()
+
+	primary.listener = inherited.take(listenerNameHTTP)
+	if primary.listener == nil {
+		if config.UnixSocket != "" {
+			primary.listener, err = listenUnix(config)
+		} else {
+			primary.listener, err = net.Listen("tcp", fmt.Sprintf(":%d", config.Port)) // Construct address from config.Port
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrListen, err)
+		}
+	}
+	servers := []*listeningServer{primary}
+
+	if config.TLSEnabled() && config.HTTPRedirectPort > 0 {
+		listener := inherited.take(listenerNameRedirect)
+		if listener == nil {
+			listener, err = net.Listen("tcp", fmt.Sprintf(":%d", config.HTTPRedirectPort))
+			if err != nil {
+				primary.listener.Close()
+				return nil, fmt.Errorf("%w: %v", ErrListen, err)
+			}
+		}
+		servers = append(servers, &listeningServer{
+			name:         "http redirect",
+			listenerName: listenerNameRedirect,
+			server:       &http.Server{Handler: redirectHandler},
+			listener:     listener,
+		})
+	}
+
+	if config.AdminAddr != "" {
+		listener := inherited.take(listenerNameAdmin)
+		if listener == nil {
+			listener, err = net.Listen("tcp", config.AdminAddr)
+			if err != nil {
+				for _, s := range servers {
+					s.listener.Close()
+				}
+				return nil, fmt.Errorf("%w: %v", ErrListen, err)
+			}
+		}
+		servers = append(servers, &listeningServer{
+			name:         "admin",
+			listenerName: listenerNameAdmin,
+			server:       &http.Server{Handler: adminHandler},
+			listener:     listener,
+		})
+	}
+
+	return servers, nil
+}
+
+// shutdown marks the server as draining, waits for the configured pre-stop
+// delay (if preStopDelay is set) so load balancers can observe the failing
+// health check, and then gracefully shuts the servers down within the
+// configured drain timeout.
+func shutdown(servers []*listeningServer, config *Config, preStopDelay bool) error {
+	draining.Store(true)
+
+	if preStopDelay && config.ShutdownDelaySeconds > 0 {
+		delay := time.Duration(config.ShutdownDelaySeconds) * time.Second
+		log.Printf("Shutdown signal received, waiting %s before draining connections...", delay)
+		time.Sleep(delay)
+	}
+
+	timeout := time.Duration(config.ShutdownTimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	log.Printf("Draining connections (timeout %s)...", timeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	errs := make(chan error, len(servers))
+	for _, s := range servers {
+		go func() {
+			if err := s.drain(ctx); err != nil {
+				s.server.Close()
+				errs <- fmt.Errorf("%s: %v", s.name, err)
+				return
+			}
+			errs <- nil
+		}()
+	}
+
+	var shutdownErr error
+	for range servers {
+		if err := <-errs; err != nil && shutdownErr == nil {
+			shutdownErr = err
+		}
+	}
+	if shutdownErr != nil {
+		return fmt.Errorf("%w: %v", ErrShutdown, shutdownErr)
+	}
+
+	log.Printf("Server stopped")
+	return nil
 }
 
 func SetupHandlers() (http.Handler, *Config) {
@@ -21,9 +363,19 @@ func SetupHandlers() (http.Handler, *Config) {
 		log.Fatalf("Error loading configuration: %v", err)
 	}
 
+	return NewHandler(config), config
+}
+
+// NewHandler builds the full handler chain for an already loaded configuration.
+func NewHandler(config *Config) http.Handler {
+	return newHandler(config, GetCachedAsset)
+}
+
+// newHandler is NewHandler with the cached assets looked up in assets.
+func newHandler(config *Config, assets assetLookup) http.Handler {
 	// Log the static directory being used
 	if config.StaticDir == "" {
-		config.StaticDir = "./client/dist"
+		config.StaticDir = DefaultStaticDir
 		log.Printf("Using default static directory: %s", config.StaticDir)
 	} else {
 		log.Printf("Using static directory: %s", config.StaticDir)
@@ -32,13 +384,53 @@ func SetupHandlers() (http.Handler, *Config) {
 	// Log the SPA fallback file being used
 	log.Printf("Using SPA fallback file: %s", config.SpaFallbackFile)
 
-	spaHandler := CreateSpaHandler(config) // Use CreateSpaHandler from handlers package
+	// Create a new ServeMux to handle multiple routes
+	mux := http.NewServeMux()
+	if config.AdminAddr == "" {
+		// Without a separate admin listener, keep the health checks on the public one
+		mux.Handle("/healthz", http.HandlerFunc(HealthzHandler))
+		mux.Handle("/livez", LivezHandler())
+		mux.Handle("/readyz", ReadyzHandler(config))
+	}
+	// The app mux routes each request to the mount with the longest matching
+	// prefix. The bare prefix, e.g. /admin, redirects to /admin/ under the base
+	// path, which the redirect ServeMux adds itself would leave out.
+	app := http.NewServeMux()
+	for _, m := range config.Mounts {
+		prefix := m.pathPrefix()
+		log.Printf("Mounting %s at %s%s/", m.StaticDir, config.basePath(), prefix)
+		app.Handle(prefix+"/", http.StripPrefix(prefix, spaChain(m.config(config), prefix, assets)))
+		app.Handle(prefix, redirectHandler(config.basePath()+prefix+"/"))
+	}
+	if config.RuntimeConfigPath != "" {
+		log.Printf("Serving runtime config at %s%s", config.basePath(), config.RuntimeConfigPath)
+		app.Handle(config.RuntimeConfigPath, SecurityHeadersMiddleware(config)(RuntimeConfigHandler(config)))
+	}
+	app.Handle("/", spaChain(config, "", assets))
+	if basePath := config.basePath(); basePath != "" {
+		log.Printf("Serving under base path %s/", basePath)
+	}
+	// All other requests go to the SPA handler, with the base path stripped
+	mux.Handle("/", BasePathHandler(config.BasePath, app))
+
+	return MetricsMiddleware(mux)
+}
 
-	// Apply caching middleware
-	cachedSPAHandler := CacheControlMiddleware(config)(spaHandler) // Use CacheControlMiddleware from middleware package
+// spaChain wraps the SPA handler for config, mounted at cachePrefix, in the
+// security header and compression middleware.
+func spaChain(config *Config, cachePrefix string, assets assetLookup) http.Handler {
+	if script := runtimeEnvScript(config.RuntimeEnvPrefix); script != nil {
+		// Let the injected window.__ENV__ script run under the CSP
+		withHash := *config
+		withHash.CSPHeader = allowScriptHash(config.CSPHeader, script)
+		config = &withHash
+	}
+	// The SPA handler sets Cache-Control itself, from the file a request
+	// resolves to rather than its path
+	spaHandler := newSpaHandler(config, cachePrefix, assets)
 
 	// Apply CSP middleware
-	cspHandler := CSPMiddleware(config)(cachedSPAHandler)
+	cspHandler := CSPMiddleware(config)(spaHandler)
 
 	// Apply HSTS middleware
 	hstsHandler := HSTSMiddleware(config)(cspHandler)
@@ -50,12 +442,15 @@ func SetupHandlers() (http.Handler, *Config) {
 	brotliCompressedHandler := BrotliHandler(securityHeadersHandler) // Use BrotliHandler from middleware package
 
 	// Apply Gzip compression middleware (fallback)
-	finalHandler := gziphandler.GzipHandler(brotliCompressedHandler)
-
-	// Create a new ServeMux to handle multiple routes
-	mux := http.NewServeMux()
-	mux.Handle("/healthz", http.HandlerFunc(HealthzHandler))
-	mux.Handle("/", finalHandler) // All other requests go to the SPA handler
+	compressedHandler := GzipHandler(brotliCompressedHandler)
 
-	return mux, config
+	// Byte ranges refer to the uncompressed file, so range requests skip the
+	// runtime compressors
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			securityHeadersHandler.ServeHTTP(w, r)
+			return
+		}
+		compressedHandler.ServeHTTP(w, r)
+	})
 }
@@ -1,7 +1,11 @@
 package server
 
 import (
+	"bufio"
 	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt" // Added import
 	"io/ioutil"
 	"net" // Added import
@@ -13,7 +17,9 @@ import (
 	"testing"
 	"time" // Added import
 
+	"github.com/andybalholm/brotli"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
 )
 
 // createTempConfigFile creates a temporary config file for testing.
@@ -44,6 +50,7 @@ func TestStartServer(t *testing.T) {
 		// Pass a config with an invalid port (e.g., -1, which is an invalid port number)
 		err := StartServer(&Config{Port: -1}, dummyHandler)
 		assert.Error(t, err)
+		assert.True(t, errors.Is(err, ErrListen))
 	})
 }
 
@@ -80,6 +87,183 @@ func TestStartServer_CorrectPort(t *testing.T) {
 	resp.Body.Close()
 }
 
+// freePort returns a TCP port that is currently free on localhost.
+func freePort(t *testing.T) int {
+	listener, err := net.Listen("tcp", ":0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// waitForServer polls url until the server accepts connections.
+func waitForServer(t *testing.T, url string) {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		resp, err := http.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("server at %s did not start in time", url)
+}
+
+func TestServe_GracefulShutdown(t *testing.T) {
+	port := freePort(t)
+	baseURL := fmt.Sprintf("http://localhost:%d", port)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", HealthzHandler)
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	})
+
+	cfg := &Config{Port: port, ShutdownDelaySeconds: 1, ShutdownTimeoutSeconds: 5}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, cancel, cfg, mux)
+	}()
+	waitForServer(t, baseURL+"/healthz")
+
+	type result struct {
+		body string
+		err  error
+	}
+	slow := make(chan result, 1)
+	go func() {
+		resp, err := http.Get(baseURL + "/slow")
+		if err != nil {
+			slow <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		slow <- result{body: string(body), err: err}
+	}()
+	<-started
+
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+
+	// During the pre-stop delay the health check fails but requests are still served.
+	resp, err := http.Get(baseURL + "/healthz")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	resp.Body.Close()
+
+	close(release)
+	res := <-slow
+	assert.NoError(t, res.err)
+	assert.Equal(t, "done", res.body)
+
+	assert.NoError(t, <-done)
+}
+
+func TestServe_H2CGracefulShutdown(t *testing.T) {
+	port := freePort(t)
+	baseURL := fmt.Sprintf("http://localhost:%d", port)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", HealthzHandler)
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	})
+
+	cfg := &Config{Port: port, H2C: true, ShutdownTimeoutSeconds: 5}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, cancel, cfg, mux)
+	}()
+	waitForServer(t, baseURL+"/healthz")
+
+	// Prior knowledge h2c, whose connections the server hijacks
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+	type result struct {
+		body  string
+		proto int
+		err   error
+	}
+	slow := make(chan result, 1)
+	go func() {
+		resp, err := client.Get(baseURL + "/slow")
+		if err != nil {
+			slow <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		slow <- result{body: string(body), proto: resp.ProtoMajor, err: err}
+	}()
+	<-started
+
+	cancel()
+	select {
+	case err := <-done:
+		t.Fatalf("serve returned with an h2c request in flight: %v", err)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	close(release)
+	res := <-slow
+	assert.NoError(t, res.err)
+	assert.Equal(t, 2, res.proto)
+	assert.Equal(t, "done", res.body)
+	assert.NoError(t, <-done)
+}
+
+func TestServe_ShutdownTimeout(t *testing.T) {
+	port := freePort(t)
+	baseURL := fmt.Sprintf("http://localhost:%d", port)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", HealthzHandler)
+	mux.HandleFunc("/stuck", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+
+	cfg := &Config{Port: port, ShutdownTimeoutSeconds: 1}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, cancel, cfg, mux)
+	}()
+	waitForServer(t, baseURL+"/healthz")
+
+	go http.Get(baseURL + "/stuck")
+	<-started
+
+	cancel()
+	err := <-done
+	assert.True(t, errors.Is(err, ErrShutdown))
+}
+
 func TestSetupHandlers(t *testing.T) {
 	// Create a temporary directory for this test
 	tempStaticDir, err := ioutil.TempDir("", "test_static_dir_setup_handlers")
@@ -150,6 +334,8 @@ func TestSetupHandlers(t *testing.T) {
 		t.Setenv("STATIC_DIR", tempStaticDir)
 		defer os.Unsetenv("STATIC_DIR")
 
+		assert.NoError(t, os.MkdirAll(filepath.Join(tempStaticDir, "assets"), 0755))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(tempStaticDir, "assets", "some.js"), []byte("// some"), 0644))
 		handler, _ := SetupHandlers()
 
 		req := httptest.NewRequest("GET", "/assets/some.js", nil)
@@ -184,3 +370,93 @@ func TestSetupHandlers(t *testing.T) {
 		assert.Equal(t, largeContent, string(decompressedBody))
 	})
 }
+
+func TestServe_H2C(t *testing.T) {
+	tempStaticDir := t.TempDir()
+	largeContent := strings.Repeat("h2c ", 1000)
+	assert.NoError(t, os.WriteFile(filepath.Join(tempStaticDir, "index.html"), []byte("<html>index</html>"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(tempStaticDir, "large.txt"), []byte(largeContent), 0644))
+
+	port := freePort(t)
+	baseURL := fmt.Sprintf("http://localhost:%d", port)
+	cfg := &Config{Port: port, StaticDir: tempStaticDir, SpaFallbackFile: "index.html", H2C: true}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, cancel, cfg, NewHandler(cfg))
+	}()
+	waitForServer(t, baseURL+"/healthz")
+
+	// Prior knowledge: speak HTTP/2 directly over a plain TCP connection.
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+
+	t.Run("brotli over h2c", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", baseURL+"/large.txt", nil)
+		req.Header.Set("Accept-Encoding", "br")
+		resp, err := client.Do(req)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer resp.Body.Close()
+		assert.Equal(t, 2, resp.ProtoMajor)
+		assert.Equal(t, "br", resp.Header.Get("Content-Encoding"))
+		body, err := ioutil.ReadAll(brotli.NewReader(resp.Body))
+		assert.NoError(t, err)
+		assert.Equal(t, largeContent, string(body))
+	})
+
+	t.Run("gzip over h2c", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", baseURL+"/large.txt", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		resp, err := client.Do(req)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer resp.Body.Close()
+		assert.Equal(t, 2, resp.ProtoMajor)
+		assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+		reader, err := gzip.NewReader(resp.Body)
+		if !assert.NoError(t, err) {
+			return
+		}
+		body, err := ioutil.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, largeContent, string(body))
+	})
+
+	t.Run("HTTP/1.1 Upgrade", func(t *testing.T) {
+		conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade, HTTP2-Settings\r\nUpgrade: h2c\r\nHTTP2-Settings: AAMAAABkAAQAAP__\r\n\r\n")
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+		assert.Equal(t, "h2c", resp.Header.Get("Upgrade"))
+	})
+
+	t.Run("plain HTTP/1.1 still served", func(t *testing.T) {
+		resp, err := http.Get(baseURL + "/")
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer resp.Body.Close()
+		assert.Equal(t, 1, resp.ProtoMajor)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	cancel()
+	assert.NoError(t, <-done)
+}
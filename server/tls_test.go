@@ -0,0 +1,186 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeSelfSignedCert generates a self-signed certificate for localhost that
+// expires after validFor and writes it and its key as PEM files into dir.
+func writeSelfSignedCert(t *testing.T, dir string, validFor time.Duration) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatalf("failed to generate serial: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(validFor),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	certFile = filepath.Join(dir, "tls.crt")
+	keyFile = filepath.Join(dir, "tls.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatalf("failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func TestHTTPSRedirectHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		port     int
+		target   string
+		host     string
+		expected string
+	}{
+		{
+			name:     "preserves path and query",
+			port:     8443,
+			target:   "/dashboard/users?page=2&sort=name",
+			host:     "example.com:8080",
+			expected: "https://example.com:8443/dashboard/users?page=2&sort=name",
+		},
+		{
+			name:     "omits default port",
+			port:     443,
+			target:   "/",
+			host:     "example.com",
+			expected: "https://example.com/",
+		},
+		{
+			name:     "IPv6 host",
+			port:     443,
+			target:   "/a",
+			host:     "[::1]:80",
+			expected: "https://[::1]/a",
+		},
+		{
+			name:     "IPv6 host with custom port",
+			port:     8443,
+			target:   "/a",
+			host:     "[::1]",
+			expected: "https://[::1]:8443/a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.target, nil)
+			req.Host = tt.host
+			rr := httptest.NewRecorder()
+
+			HTTPSRedirectHandler(tt.port).ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusMovedPermanently, rr.Code)
+			assert.Equal(t, tt.expected, rr.Header().Get("Location"))
+		})
+	}
+}
+
+func TestServe_TLSWithRedirect(t *testing.T) {
+	certFile, keyFile := writeSelfSignedCert(t, t.TempDir(), 24*time.Hour)
+	port := freePort(t)
+	redirectPort := freePort(t)
+
+	cfg := &Config{
+		Port:             port,
+		HSTSMaxAge:       31536000,
+		TLSCertFile:      certFile,
+		TLSKeyFile:       keyFile,
+		HTTPRedirectPort: redirectPort,
+	}
+	handler := HSTSMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, cancel, cfg, handler)
+	}()
+
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	httpsURL := fmt.Sprintf("https://localhost:%d/", port)
+	deadline := time.Now().Add(2 * time.Second)
+	var resp *http.Response
+	var err error
+	for time.Now().Before(deadline) {
+		if resp, err = client.Get(httpsURL); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !assert.NoError(t, err) {
+		return
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "max-age=31536000; includeSubDomains", resp.Header.Get("Strict-Transport-Security"))
+
+	resp, err = client.Get(fmt.Sprintf("http://localhost:%d/about?tab=team", redirectPort))
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode)
+		assert.Equal(t, fmt.Sprintf("https://localhost:%d/about?tab=team", port), resp.Header.Get("Location"))
+	}
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestServe_TLSInvalidCertificate(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &Config{
+		Port:        freePort(t),
+		TLSCertFile: filepath.Join(dir, "missing.crt"),
+		TLSKeyFile:  filepath.Join(dir, "missing.key"),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := serve(ctx, cancel, cfg, http.NotFoundHandler())
+	assert.Error(t, err)
+}
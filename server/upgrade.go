@@ -0,0 +1,58 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Environment variables used to hand listeners from a running process to the
+// new binary started by a SIGUSR2 upgrade.
+const (
+	envUpgradeListenFds     = "SPA_SERVER_LISTEN_FDS"
+	envUpgradeListenFdNames = "SPA_SERVER_LISTEN_FDNAMES"
+	envUpgradeReadyFd       = "SPA_SERVER_READY_FD"
+)
+
+// upgradeTimeout bounds how long the old process waits for the new one to become ready.
+const upgradeTimeout = 60 * time.Second
+
+// upgradeListeners returns the listeners handed over by a parent process
+// during a binary upgrade, or nil if the process was started normally.
+// Inherited descriptors start right after stderr, just as with systemd.
+func upgradeListeners() (*inheritedListeners, error) {
+	value := os.Getenv(envUpgradeListenFds)
+	if value == "" {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv(envUpgradeListenFdNames), ":")
+	os.Unsetenv(envUpgradeListenFds)
+	os.Unsetenv(envUpgradeListenFdNames)
+
+	count, err := strconv.Atoi(value)
+	if err != nil || count <= 0 {
+		return nil, fmt.Errorf("invalid %s: %s", envUpgradeListenFds, value)
+	}
+	return listenersFromFds(sdListenFdsStart, count, names)
+}
+
+// notifyUpgradeReady tells the parent of an upgrade that this process is
+// serving, so the parent can start draining. It is a no-op otherwise.
+func notifyUpgradeReady() error {
+	value := os.Getenv(envUpgradeReadyFd)
+	if value == "" {
+		return nil
+	}
+	os.Unsetenv(envUpgradeReadyFd)
+
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %s", envUpgradeReadyFd, value)
+	}
+	ready := os.NewFile(uintptr(fd), "upgrade-ready")
+	defer ready.Close()
+	_, err = ready.Write([]byte{1})
+	return err
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package server
+
+import (
+	"errors"
+	"os"
+)
+
+// upgradeSignals is empty where listener hand-off is not supported.
+var upgradeSignals []os.Signal
+
+func startUpgrade(servers []*listeningServer) error {
+	return errors.New("binary upgrades are not supported on this platform")
+}
@@ -0,0 +1,97 @@
+//go:build unix
+
+package server
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// upgradeSignals trigger a zero-downtime upgrade to the binary on disk.
+var upgradeSignals = []os.Signal{syscall.SIGUSR2}
+
+// startUpgrade starts the current executable as a child process, handing it
+// the listening sockets of servers, and waits until the child reports that it
+// is serving. On success the caller should drain and exit; on failure it keeps
+// serving and the child, if still running, is killed.
+func startUpgrade(servers []*listeningServer) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	var files []*os.File
+	var names []string
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, s := range servers {
+		filer, ok := s.listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			return fmt.Errorf("%s listener cannot be handed over", s.name)
+		}
+		f, err := filer.File()
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+		names = append(names, s.listenerName)
+	}
+
+	readyRead, readyWrite, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyRead.Close()
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = append(files, readyWrite)
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("%s=%d", envUpgradeListenFds, len(files)),
+		fmt.Sprintf("%s=%s", envUpgradeListenFdNames, strings.Join(names, ":")),
+		fmt.Sprintf("%s=%d", envUpgradeReadyFd, sdListenFdsStart+len(files)),
+	)
+	err = cmd.Start()
+	readyWrite.Close() // Only the child holds the write end, so its exit unblocks the read below
+	if err != nil {
+		return err
+	}
+	go cmd.Wait() // Reap the child if it exits while we are still running
+	log.Printf("Started new process %d for upgrade, waiting for it to become ready...", cmd.Process.Pid)
+
+	ready := make(chan error, 1)
+	go func() {
+		_, err := readyRead.Read(make([]byte, 1))
+		ready <- err
+	}()
+
+	select {
+	case err := <-ready:
+		if err != nil {
+			return fmt.Errorf("new process exited before becoming ready")
+		}
+	case <-time.After(upgradeTimeout):
+		cmd.Process.Kill()
+		return fmt.Errorf("new process did not become ready within %s", upgradeTimeout)
+	}
+
+	// The socket files now belong to the new process as well.
+	for _, s := range servers {
+		if unixListener, ok := s.listener.(*net.UnixListener); ok {
+			unixListener.SetUnlinkOnClose(false)
+		}
+	}
+	log.Printf("New process %d is ready, draining this process", cmd.Process.Pid)
+	return nil
+}
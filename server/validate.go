@@ -0,0 +1,325 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// ValidationIssue is a single problem found by ValidateConfig. Field is the
+// config file key of the offending setting.
+type ValidationIssue struct {
+	Field   string
+	Message string
+}
+
+func (i ValidationIssue) String() string {
+	return fmt.Sprintf("%s: %s", i.Field, i.Message)
+}
+
+// ValidationReport collects the problems found in a configuration. Errors make
+// the configuration unusable; warnings are worth a look but do not fail a check.
+type ValidationReport struct {
+	Errors   []ValidationIssue
+	Warnings []ValidationIssue
+}
+
+// OK reports whether the configuration has no errors.
+func (r *ValidationReport) OK() bool {
+	return len(r.Errors) == 0
+}
+
+func (r *ValidationReport) errorf(field, format string, args ...interface{}) {
+	r.Errors = append(r.Errors, ValidationIssue{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *ValidationReport) warnf(field, format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, ValidationIssue{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Write prints the report in a human readable form.
+func (r *ValidationReport) Write(w io.Writer) {
+	for _, issue := range r.Errors {
+		fmt.Fprintf(w, "error: %s\n", issue)
+	}
+	for _, issue := range r.Warnings {
+		fmt.Fprintf(w, "warning: %s\n", issue)
+	}
+	if r.OK() {
+		fmt.Fprintf(w, "Configuration OK (%d warnings)\n", len(r.Warnings))
+	} else {
+		fmt.Fprintf(w, "Configuration invalid (%d errors, %d warnings)\n", len(r.Errors), len(r.Warnings))
+	}
+}
+
+// Error summarises the report's errors so it can be returned as an error.
+func (r *ValidationReport) Error() string {
+	messages := make([]string, len(r.Errors))
+	for i, issue := range r.Errors {
+		messages[i] = issue.String()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// ValidateConfig checks a loaded configuration against the environment it will
+// run in: ports, the static directory and fallback file, TLS files and the
+// values of the security headers. LoadConfig only rejects values it cannot
+// parse; ValidateConfig also catches settings that would break at runtime.
+func ValidateConfig(config *Config) *ValidationReport {
+	report := &ValidationReport{}
+
+	validatePorts(report, config)
+	validateStaticFiles(report, config)
+	validateTLSFiles(report, config)
+	validateSecurityHeaders(report, config)
+	validateMountFiles(report, config)
+
+	if config.RuntimeEnvPrefix != "" && len(runtimeEnv(config.RuntimeEnvPrefix)) == 0 {
+		report.warnf("runtime_env_prefix", "no environment variables start with %s, window.__ENV__ will be empty", config.RuntimeEnvPrefix)
+	}
+
+	validateRuntimeConfig(report, config)
+
+	if config.ShutdownDelaySeconds < 0 {
+		report.errorf("shutdown_delay_seconds", "must not be negative, got %d", config.ShutdownDelaySeconds)
+	}
+	if config.ShutdownTimeoutSeconds < 0 {
+		report.errorf("shutdown_timeout_seconds", "must not be negative, got %d", config.ShutdownTimeoutSeconds)
+	}
+
+	return report
+}
+
+func validatePorts(report *ValidationReport, config *Config) {
+	if config.UnixSocket == "" && (config.Port < 1 || config.Port > 65535) {
+		report.errorf("port", "%d is out of range (1-65535)", config.Port)
+	}
+	if config.HTTPRedirectPort < 0 || config.HTTPRedirectPort > 65535 {
+		report.errorf("http_redirect_port", "%d is out of range (1-65535)", config.HTTPRedirectPort)
+	} else if config.HTTPRedirectPort != 0 && config.UnixSocket == "" && config.HTTPRedirectPort == config.Port {
+		report.errorf("http_redirect_port", "must differ from port %d", config.Port)
+	}
+	if config.UnixSocket != "" {
+		if info, err := os.Stat(filepath.Dir(config.UnixSocket)); err != nil {
+			report.errorf("unix_socket", "socket directory is not accessible: %v", err)
+		} else if !info.IsDir() {
+			report.errorf("unix_socket", "%s is not a directory", filepath.Dir(config.UnixSocket))
+		}
+	}
+}
+
+func validateStaticFiles(report *ValidationReport, config *Config) {
+	staticDir := config.StaticDirOrDefault()
+	if config.StaticDir == "" {
+		report.warnf("static_dir", "not set, using the default %s", DefaultStaticDir)
+	}
+
+	info, err := os.Stat(staticDir)
+	if err != nil {
+		report.errorf("static_dir", "%v", err)
+		return
+	}
+	if !info.IsDir() {
+		report.errorf("static_dir", "%s is not a directory", staticDir)
+		return
+	}
+	if err := checkStaticDir(staticDir); err != nil {
+		report.errorf("static_dir", "%v", err)
+		return
+	}
+
+	if config.NotFoundFile != "" {
+		if info, err := os.Stat(filepath.Join(staticDir, config.NotFoundFile)); err != nil {
+			report.errorf("not_found_file", "%v", err)
+		} else if info.IsDir() {
+			report.errorf("not_found_file", "%s is a directory", config.NotFoundFile)
+		}
+	}
+
+	fallbackPath := filepath.Join(staticDir, config.SpaFallbackFile)
+	if err := checkFallbackFile(staticDir, config.SpaFallbackFile); err != nil {
+		report.errorf("spa_fallback_file", "%v", err)
+		return
+	}
+	file, err := os.Open(fallbackPath)
+	if err != nil {
+		report.errorf("spa_fallback_file", "%v", err)
+		return
+	}
+	file.Close()
+}
+
+func validateTLSFiles(report *ValidationReport, config *Config) {
+	for _, f := range []struct{ field, path string }{
+		{"tls_cert_file", config.TLSCertFile},
+		{"tls_key_file", config.TLSKeyFile},
+		{"acme_ca_cert_file", config.ACMECACertFile},
+	} {
+		if f.path == "" {
+			continue
+		}
+		file, err := os.Open(f.path)
+		if err != nil {
+			report.errorf(f.field, "%v", err)
+			continue
+		}
+		file.Close()
+	}
+}
+
+// validHeaderValues lists the values accepted for headers with a fixed set of
+// valid values, keyed by config field.
+var validHeaderValues = map[string][]string{
+	"x_content_type_options": {"nosniff"},
+	"x_frame_options":        {"DENY", "SAMEORIGIN"},
+	"referrer_policy": {
+		"no-referrer", "no-referrer-when-downgrade", "origin", "origin-when-cross-origin",
+		"same-origin", "strict-origin", "strict-origin-when-cross-origin", "unsafe-url",
+	},
+}
+
+func validateSecurityHeaders(report *ValidationReport, config *Config) {
+	validateHeaderValues(report, config)
+	if config.HSTSMaxAge < 0 {
+		report.errorf("hsts_max_age", "must not be negative, got %d", config.HSTSMaxAge)
+	} else if config.HSTSMaxAge > 0 && !config.TLSEnabled() {
+		report.warnf("hsts_max_age", "has no effect unless TLS is enabled")
+	}
+}
+
+// validateHeaderValues checks the configured header values, including the
+// syntax of the Content-Security-Policy.
+func validateHeaderValues(report *ValidationReport, config *Config) {
+	headers := []struct{ field, value string }{
+		{"csp_header", config.CSPHeader},
+		{"x_content_type_options", config.XContentTypeOptions},
+		{"x_frame_options", config.XFrameOptions},
+		{"referrer_policy", config.ReferrerPolicy},
+		{"permissions_policy", config.PermissionsPolicy},
+	}
+	for _, h := range headers {
+		if h.value == "" {
+			continue
+		}
+		if !httpguts.ValidHeaderFieldValue(h.value) {
+			report.errorf(h.field, "contains characters that are not allowed in a header value")
+			continue
+		}
+		valid, ok := validHeaderValues[h.field]
+		if !ok {
+			continue
+		}
+		values := []string{h.value}
+		if h.field == "referrer_policy" {
+			// Referrer-Policy may list fallbacks separated by commas.
+			values = strings.Split(h.value, ",")
+		}
+		for _, v := range values {
+			if !containsFold(valid, strings.TrimSpace(v)) {
+				report.errorf(h.field, "unsupported value %q, expected one of %s", strings.TrimSpace(v), strings.Join(valid, ", "))
+			}
+		}
+	}
+
+	if config.CSPHeader != "" && httpguts.ValidHeaderFieldValue(config.CSPHeader) {
+		validateCSP(report, config.CSPHeader)
+	}
+}
+
+// validateRuntimeConfig warns about runtime config that would not be served.
+func validateRuntimeConfig(report *ValidationReport, config *Config) {
+	if config.RuntimeConfigPath == "" {
+		if len(config.RuntimeConfigVars) > 0 {
+			report.warnf("runtime_config_vars", "has no effect without runtime_config_path")
+		}
+		if len(config.RuntimeConfig) > 0 {
+			report.warnf("runtime_config", "has no effect without runtime_config_path")
+		}
+		return
+	}
+	for _, name := range config.RuntimeConfigVars {
+		if _, ok := os.LookupEnv(name); !ok {
+			report.warnf("runtime_config_vars", "%s is not set and will be left out", name)
+		}
+	}
+}
+
+// validateMountFiles checks each mount's static directory, fallback file and
+// header values. Issues are reported against e.g. mounts[0].static_dir.
+func validateMountFiles(report *ValidationReport, config *Config) {
+	for i, m := range config.Mounts {
+		mountReport := &ValidationReport{}
+		validateStaticFiles(mountReport, m.config(config))
+		// Only the mount's own headers, the inherited ones are checked already
+		validateHeaderValues(mountReport, m.config(&Config{}))
+
+		prefix := fmt.Sprintf("mounts[%d].", i)
+		for _, issue := range mountReport.Errors {
+			report.errorf(prefix+issue.Field, "%s", issue.Message)
+		}
+		for _, issue := range mountReport.Warnings {
+			report.warnf(prefix+issue.Field, "%s", issue.Message)
+		}
+	}
+}
+
+func containsFold(values []string, v string) bool {
+	for _, candidate := range values {
+		if strings.EqualFold(candidate, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// cspDirectives are the directives defined by CSP Level 3 and its extensions.
+var cspDirectives = map[string]bool{
+	"base-uri": true, "block-all-mixed-content": true, "child-src": true, "connect-src": true,
+	"default-src": true, "fenced-frame-src": true, "font-src": true, "form-action": true,
+	"frame-ancestors": true, "frame-src": true, "img-src": true, "manifest-src": true,
+	"media-src": true, "object-src": true, "report-to": true, "report-uri": true,
+	"require-trusted-types-for": true, "sandbox": true, "script-src": true,
+	"script-src-attr": true, "script-src-elem": true, "style-src": true,
+	"style-src-attr": true, "style-src-elem": true, "trusted-types": true,
+	"upgrade-insecure-requests": true, "worker-src": true,
+}
+
+// cspKeywords are source expressions that must be single-quoted.
+var cspKeywords = map[string]bool{
+	"self": true, "none": true, "unsafe-inline": true, "unsafe-eval": true,
+	"strict-dynamic": true, "unsafe-hashes": true, "report-sample": true,
+	"wasm-unsafe-eval": true, "unsafe-allow-redirects": true,
+}
+
+// validateCSP checks the syntax of a Content-Security-Policy value: directive
+// names, duplicates and unquoted keywords such as self or none.
+func validateCSP(report *ValidationReport, policy string) {
+	seen := make(map[string]bool)
+	for _, directive := range strings.Split(policy, ";") {
+		tokens := strings.Fields(directive)
+		if len(tokens) == 0 {
+			continue
+		}
+		name := strings.ToLower(tokens[0])
+		if !cspDirectives[name] {
+			report.errorf("csp_header", "unknown directive %q", tokens[0])
+			continue
+		}
+		if seen[name] {
+			report.warnf("csp_header", "duplicate directive %q, browsers ignore all but the first", name)
+		}
+		seen[name] = true
+
+		for _, source := range tokens[1:] {
+			if cspKeywords[strings.ToLower(source)] {
+				report.errorf("csp_header", "keyword %s in %s must be quoted as '%s'", source, name, source)
+			} else if strings.HasPrefix(source, "'") != strings.HasSuffix(source, "'") || source == "'" {
+				report.errorf("csp_header", "unbalanced quotes in %s source %s", name, source)
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// issueFields returns the fields of the given issues, in order.
+func issueFields(issues []ValidationIssue) []string {
+	var fields []string
+	for _, issue := range issues {
+		fields = append(fields, issue.Field)
+	}
+	return fields
+}
+
+func validStaticDir(t *testing.T) string {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html></html>"), 0644))
+	return dir
+}
+
+func TestValidateConfig_Valid(t *testing.T) {
+	config := &Config{
+		StaticDir:       validStaticDir(t),
+		SpaFallbackFile: "index.html",
+		Port:            8081,
+		CSPHeader:       "default-src 'self'; img-src 'self' data: https://cdn.example.com; upgrade-insecure-requests",
+		XFrameOptions:   "sameorigin",
+		ReferrerPolicy:  "no-referrer, strict-origin-when-cross-origin",
+	}
+	report := ValidateConfig(config)
+	assert.True(t, report.OK(), report.Error())
+	assert.Empty(t, report.Warnings)
+
+	var out bytes.Buffer
+	report.Write(&out)
+	assert.Equal(t, "Configuration OK (0 warnings)\n", out.String())
+}
+
+func TestValidateConfig_Errors(t *testing.T) {
+	staticDir := validStaticDir(t)
+
+	tests := []struct {
+		name       string
+		config     Config
+		wantFields []string
+	}{
+		{"port out of range", Config{Port: 70000}, []string{"port"}},
+		{"port zero", Config{Port: 0}, []string{"port"}},
+		{"unix socket ignores port", Config{Port: 0, UnixSocket: filepath.Join(staticDir, "spa.sock")}, nil},
+		{"missing unix socket dir", Config{UnixSocket: "/does/not/exist/spa.sock"}, []string{"unix_socket"}},
+		{"redirect port collides", Config{Port: 8443, HTTPRedirectPort: 8443}, []string{"http_redirect_port"}},
+		{"missing static dir", Config{Port: 8081, StaticDir: filepath.Join(staticDir, "missing")}, []string{"static_dir"}},
+		{"missing fallback file", Config{Port: 8081, SpaFallbackFile: "app.html"}, []string{"spa_fallback_file"}},
+		{"missing not found file", Config{Port: 8081, NotFoundFile: "404.html"}, []string{"not_found_file"}},
+		{"missing cert file", Config{Port: 8081, TLSCertFile: "missing.crt", TLSKeyFile: "missing.key"}, []string{"tls_cert_file", "tls_key_file"}},
+		{"unknown csp directive", Config{Port: 8081, CSPHeader: "default-src 'self'; scrip-src 'self'"}, []string{"csp_header"}},
+		{"unquoted csp keyword", Config{Port: 8081, CSPHeader: "default-src self"}, []string{"csp_header"}},
+		{"unbalanced csp quote", Config{Port: 8081, CSPHeader: "script-src 'self"}, []string{"csp_header"}},
+		{"header injection", Config{Port: 8081, PermissionsPolicy: "camera=()\r\nX-Evil: 1"}, []string{"permissions_policy"}},
+		{"bad x-frame-options", Config{Port: 8081, XFrameOptions: "ALLOW-FROM https://example.com"}, []string{"x_frame_options"}},
+		{"x-frame-options list", Config{Port: 8081, XFrameOptions: "DENY, SAMEORIGIN"}, []string{"x_frame_options"}},
+		{"bad x-content-type-options", Config{Port: 8081, XContentTypeOptions: "sniff"}, []string{"x_content_type_options"}},
+		{"bad referrer policy", Config{Port: 8081, ReferrerPolicy: "never"}, []string{"referrer_policy"}},
+		{"negative hsts", Config{Port: 8081, HSTSMaxAge: -1}, []string{"hsts_max_age"}},
+		{"negative shutdown timeout", Config{Port: 8081, ShutdownTimeoutSeconds: -1}, []string{"shutdown_timeout_seconds"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			if config.StaticDir == "" {
+				config.StaticDir = staticDir
+			}
+			if config.SpaFallbackFile == "" {
+				config.SpaFallbackFile = "index.html"
+			}
+			report := ValidateConfig(&config)
+			assert.Equal(t, tt.wantFields, issueFields(report.Errors))
+		})
+	}
+}
+
+func TestValidateConfig_Warnings(t *testing.T) {
+	config := &Config{
+		StaticDir:       validStaticDir(t),
+		SpaFallbackFile: "index.html",
+		Port:            8081,
+		CSPHeader:       "default-src 'self'; default-src 'none'",
+		HSTSMaxAge:      31536000,
+	}
+	report := ValidateConfig(config)
+	assert.True(t, report.OK())
+	assert.Equal(t, []string{"csp_header", "hsts_max_age"}, issueFields(report.Warnings))
+}
+
+func TestValidateConfig_DefaultStaticDir(t *testing.T) {
+	originalDir, _ := os.Getwd()
+	defer os.Chdir(originalDir)
+	assert.NoError(t, os.Chdir(t.TempDir()))
+
+	report := ValidateConfig(&Config{Port: 8081, SpaFallbackFile: "index.html"})
+	assert.Equal(t, []string{"static_dir"}, issueFields(report.Warnings))
+	assert.Equal(t, []string{"static_dir"}, issueFields(report.Errors))
+
+	var out bytes.Buffer
+	report.Write(&out)
+	assert.Contains(t, out.String(), "warning: static_dir: not set, using the default ./client/dist")
+	assert.Contains(t, out.String(), "Configuration invalid (1 errors, 1 warnings)")
+}
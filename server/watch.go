@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// fileWatcher reloads something loaded from files, such as the configuration
+// or the TLS certificate, when the files change or SIGHUP is received. A
+// reload that fails is logged and what was loaded before stays in use.
+type fileWatcher struct {
+	what     string // what is reloaded, for log messages
+	interval time.Duration
+	stampFn  func() string // changes whenever the files do
+	reloadFn func() error
+
+	// stamp identifies the file versions last attempted, to detect changes.
+	stamp string
+}
+
+// newFileWatcher returns a watcher for the files as they are now.
+func newFileWatcher(what string, interval time.Duration, stamp func() string, reload func() error) fileWatcher {
+	return fileWatcher{what: what, interval: interval, stampFn: stamp, reloadFn: reload, stamp: stamp()}
+}
+
+// filesStamp returns a string that changes whenever one of the files is
+// replaced, created or removed. os.Stat follows symlinks, so atomic symlink
+// swaps such as Kubernetes secret updates are detected too.
+func filesStamp(paths ...string) string {
+	stamp := ""
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			stamp += fmt.Sprintf("%s:%d-%d;", path, info.ModTime().UnixNano(), info.Size())
+		} else {
+			stamp += path + ":missing;"
+		}
+	}
+	return stamp
+}
+
+// reloadIfChanged reloads if the files changed since the last attempt.
+func (fw *fileWatcher) reloadIfChanged() {
+	stamp := fw.stampFn()
+	if stamp == fw.stamp {
+		return
+	}
+	fw.stamp = stamp
+	fw.reloadAndLog()
+}
+
+func (fw *fileWatcher) reloadAndLog() {
+	if err := fw.reloadFn(); err != nil {
+		log.Printf("Error reloading %s, keeping previous %s: %v", fw.what, fw.what, err)
+	}
+}
+
+// watch polls the files and listens for SIGHUP until ctx is done.
+func (fw *fileWatcher) watch(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(hup)
+		ticker := time.NewTicker(fw.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				fw.reloadIfChanged()
+			case <-hup:
+				log.Printf("SIGHUP received, reloading %s", fw.what)
+				fw.stamp = fw.stampFn()
+				fw.reloadAndLog()
+			}
+		}
+	}()
+}
@@ -0,0 +1,170 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// buildBinary builds this module into path with the given version string.
+func buildBinary(t *testing.T, path, version string) {
+	tmp := path + ".tmp"
+	cmd := exec.Command("go", "build", "-o", tmp, "-ldflags", "-X main.version="+version, ".")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go build failed: %v\n%s", err, out)
+	}
+	// Replace the binary atomically, as a deployment would
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestZeroDowntimeUpgrade(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the server binary")
+	}
+
+	dir := t.TempDir()
+	staticDir := filepath.Join(dir, "static")
+	if err := os.Mkdir(staticDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(staticDir, "index.html"), []byte("<html>app</html>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	baseURL := fmt.Sprintf("http://localhost:%d", port)
+
+	binary := filepath.Join(dir, "go-react-spa-server")
+	buildBinary(t, binary, "v1")
+
+	logPath := filepath.Join(dir, "server.log")
+	logFile, err := os.Create(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logFile.Close()
+
+	parent := exec.Command(binary)
+	parent.Dir = dir
+	parent.Env = append(os.Environ(), "PORT="+strconv.Itoa(port), "STATIC_DIR="+staticDir)
+	parent.Stdout = logFile
+	parent.Stderr = logFile
+	if err := parent.Start(); err != nil {
+		t.Fatal(err)
+	}
+	parentExited := make(chan error, 1)
+	go func() { parentExited <- parent.Wait() }()
+	defer parent.Process.Kill()
+
+	waitUntil(t, 10*time.Second, func() bool {
+		resp, err := http.Get(baseURL + "/healthz")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	})
+
+	// Deploy the new build while the old one keeps running
+	buildBinary(t, binary, "v2")
+
+	// Keep requesting throughout the upgrade; no request may fail.
+	var failures atomic.Int32
+	var requests atomic.Int32
+	stopLoad := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+		for {
+			select {
+			case <-stopLoad:
+				return
+			default:
+			}
+			resp, err := client.Get(baseURL + "/")
+			requests.Add(1)
+			if err != nil || resp.StatusCode != http.StatusOK {
+				failures.Add(1)
+			}
+			if err == nil {
+				resp.Body.Close()
+			}
+		}
+	}()
+
+	if err := parent.Process.Signal(syscall.SIGUSR2); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-parentExited:
+		if err != nil {
+			t.Errorf("old process exited with error: %v", err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("old process did not exit after upgrade")
+	}
+
+	time.Sleep(200 * time.Millisecond) // Keep the load running against the new process alone
+	close(stopLoad)
+	wg.Wait()
+
+	logs, _ := os.ReadFile(logPath)
+	match := regexp.MustCompile(`Starting go-react-spa-server v2 \(pid (\d+)\)`).FindSubmatch(logs)
+	if match == nil {
+		t.Fatalf("new build did not start, logs:\n%s", logs)
+	}
+	childPid, _ := strconv.Atoi(string(match[1]))
+	defer syscall.Kill(childPid, syscall.SIGKILL)
+
+	if failures.Load() != 0 {
+		t.Errorf("%d of %d requests failed during the upgrade", failures.Load(), requests.Load())
+	}
+
+	resp, err := http.Get(baseURL + "/")
+	if err != nil {
+		t.Fatalf("new process is not serving: %v", err)
+	}
+	resp.Body.Close()
+
+	if err := syscall.Kill(childPid, syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	waitUntil(t, 10*time.Second, func() bool {
+		logs, _ := os.ReadFile(logPath)
+		return strings.Count(string(logs), "Server stopped") == 2
+	})
+}
+
+func waitUntil(t *testing.T, timeout time.Duration, condition func() bool) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("condition not met in time")
+}